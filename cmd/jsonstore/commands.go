@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+// command is a command which works on an opened store.
+// It is shared by the command line and the REPL.
+type command struct {
+	// create makes a missing file an empty store.
+	create bool
+
+	// fn runs the command, and reports whether the store is modified.
+	fn func(ks *jsonstore.JSONStore, args []string, stdin io.Reader, stdout io.Writer) (bool, error)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get":      {fn: cmdGet},
+		"set":      {create: true, fn: cmdSet},
+		"del":      {fn: cmdDel},
+		"keys":     {fn: cmdKeys},
+		"count":    {fn: cmdCount},
+		"dump":     {fn: cmdDump},
+		"validate": {fn: cmdValidate},
+	}
+}
+
+var errUsage = errors.New("invalid arguments; run without arguments for the usage")
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+func cmdGet(ks *jsonstore.JSONStore, args []string, stdin io.Reader, stdout io.Writer) (bool, error) {
+	if len(args) != 1 {
+		return false, errUsage
+	}
+	value, err := ks.GetRawUnsafe(args[0])
+	if err != nil {
+		return false, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, value, "", "  "); err != nil {
+		return false, err
+	}
+	buf.WriteByte('\n')
+	_, err = buf.WriteTo(stdout)
+	return false, err
+}
+
+func cmdSet(ks *jsonstore.JSONStore, args []string, stdin io.Reader, stdout io.Writer) (bool, error) {
+	fs := newFlagSet("set")
+	str := fs.Bool("string", false, "store VALUE as a JSON string")
+	if err := fs.Parse(args); err != nil {
+		return false, err
+	}
+	args = fs.Args()
+	var value []byte
+	switch len(args) {
+	case 1:
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return false, err
+		}
+		value = b
+	case 2:
+		value = []byte(args[1])
+	default:
+		return false, errUsage
+	}
+
+	if *str {
+		value = bytes.TrimSuffix(value, []byte("\n"))
+		if err := ks.Set(args[0], string(value)); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err := ks.SetRaw(args[0], value); err != nil {
+		if err == jsonstore.ErrInvalidJSON {
+			err = fmt.Errorf("%v; use -string for storing a string", err)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func cmdDel(ks *jsonstore.JSONStore, args []string, stdin io.Reader, stdout io.Writer) (bool, error) {
+	if len(args) == 0 {
+		return false, errUsage
+	}
+	modified := false
+	var err error
+	for _, key := range args {
+		if derr := ks.CompareAndDelete(key, jsonstore.AnyVersion); derr != nil {
+			err = derr
+			continue
+		}
+		modified = true
+	}
+	return modified, err
+}
+
+// matchingKeys returns the sorted keys matching the pattern in args.
+func matchingKeys(name string, ks *jsonstore.JSONStore, args []string) ([]string, error) {
+	fs := newFlagSet(name)
+	useRegexp := fs.Bool("regex", false, "PATTERN is a regular expression")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	args = fs.Args()
+	if len(args) > 1 {
+		return nil, errUsage
+	}
+
+	match := func(key string) bool { return true }
+	if len(args) == 1 {
+		pattern := args[0]
+		if *useRegexp {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			match = re.MatchString
+		} else {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, err
+			}
+			match = func(key string) bool {
+				ok, _ := path.Match(pattern, key)
+				return ok
+			}
+		}
+	}
+
+	var keys []string
+	for _, key := range ks.Keys() {
+		if match(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func cmdKeys(ks *jsonstore.JSONStore, args []string, stdin io.Reader, stdout io.Writer) (bool, error) {
+	keys, err := matchingKeys("keys", ks, args)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		if _, err := fmt.Fprintln(stdout, key); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func cmdCount(ks *jsonstore.JSONStore, args []string, stdin io.Reader, stdout io.Writer) (bool, error) {
+	keys, err := matchingKeys("count", ks, args)
+	if err != nil {
+		return false, err
+	}
+	_, err = fmt.Fprintln(stdout, len(keys))
+	return false, err
+}
+
+func cmdDump(ks *jsonstore.JSONStore, args []string, stdin io.Reader, stdout io.Writer) (bool, error) {
+	fs := newFlagSet("dump")
+	compact := fs.Bool("compact", false, "print in the compact form")
+	if err := fs.Parse(args); err != nil {
+		return false, err
+	}
+	if fs.NArg() != 0 {
+		return false, errUsage
+	}
+
+	data := map[string]json.RawMessage{}
+	ks.Range(func(key string, value json.RawMessage) bool {
+		data[key] = value
+		return true
+	})
+	var b []byte
+	var err error
+	if *compact {
+		b, err = json.Marshal(data)
+	} else {
+		b, err = json.MarshalIndent(data, "", "  ")
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = stdout.Write(append(b, '\n'))
+	return false, err
+}
+
+func cmdValidate(ks *jsonstore.JSONStore, args []string, stdin io.Reader, stdout io.Writer) (bool, error) {
+	fs := newFlagSet("validate")
+	schemaFile := fs.String("schema", "", "the file of the JSON Schema")
+	prefix := fs.String("prefix", "", "validate the keys with PREFIX")
+	pattern := fs.String("pattern", "", "validate the keys matching PATTERN")
+	if err := fs.Parse(args); err != nil {
+		return false, err
+	}
+	if fs.NArg() != 0 || (*prefix != "" && *pattern != "") {
+		return false, errUsage
+	}
+
+	// the file is valid JSON, because it has been opened.
+	if *schemaFile != "" {
+		b, err := ioutil.ReadFile(*schemaFile)
+		if err != nil {
+			return false, err
+		}
+		schema, err := jsonstore.CompileSchema(b)
+		if err != nil {
+			return false, err
+		}
+		if *pattern != "" {
+			if err := ks.RegisterSchema(*pattern, schema); err != nil {
+				return false, err
+			}
+		} else {
+			ks.RegisterSchemaPrefix(*prefix, schema)
+		}
+	}
+
+	err := ks.Validate()
+	if errs, ok := err.(jsonstore.ValidationErrors); ok {
+		for _, e := range errs {
+			for _, v := range e.Violations {
+				fmt.Fprintf(stdout, "%s: %s\n", e.Key, v)
+			}
+		}
+		return false, fmt.Errorf("%d invalid values", len(errs))
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = fmt.Fprintln(stdout, "ok")
+	return false, err
+}
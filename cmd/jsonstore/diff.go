@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+// diff prints the differences from a to the first file of args, and returns the exit status.
+func diff(a string, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	fs := newFlagSet("diff")
+	useJSON := fs.Bool("json", false, "print in JSON")
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	ka, err := jsonstore.OpenFile(a, jsonstore.Options{})
+	if err != nil {
+		fmt.Fprintln(stderr, "jsonstore:", err)
+		return 2
+	}
+	kb, err := jsonstore.OpenFile(args[0], jsonstore.Options{})
+	if err != nil {
+		fmt.Fprintln(stderr, "jsonstore:", err)
+		return 2
+	}
+
+	diffs := jsonstore.Diff(ka, kb)
+	format := jsonstore.DiffText
+	if *useJSON {
+		format = jsonstore.DiffJSON
+	}
+	if err := jsonstore.WriteDiff(stdout, diffs, format); err != nil {
+		fmt.Fprintln(stderr, "jsonstore:", err)
+		return 2
+	}
+	if len(diffs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// merge merges the files in args from base.
+// The unresolved conflicts keep our values, and they are reported to stderr.
+func merge(base string, args []string, stderr io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	fs := newFlagSet("merge")
+	out := fs.String("o", "", "the output file; OURS by default")
+	prefer := fs.String("prefer", "", "resolve the conflicts by taking ours or theirs")
+	objects := fs.Bool("objects", false, "merge the members of conflicting objects")
+	if err := fs.Parse(args[2:]); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	var resolve jsonstore.ConflictResolver
+	switch *prefer {
+	case "":
+	case "ours":
+		resolve = jsonstore.ResolveOurs
+	case "theirs":
+		resolve = jsonstore.ResolveTheirs
+	default:
+		return fmt.Errorf("unknown -prefer %q", *prefer)
+	}
+	if *objects {
+		resolve = jsonstore.ResolveObjects(resolve)
+	}
+
+	var stores [3]*jsonstore.JSONStore
+	for i, filename := range []string{base, args[0], args[1]} {
+		ks, err := jsonstore.OpenFile(filename, jsonstore.Options{})
+		if err != nil {
+			return err
+		}
+		stores[i] = ks
+	}
+	merged, err := jsonstore.Merge(stores[0], stores[1], stores[2], resolve)
+	cerr, conflicted := err.(*jsonstore.MergeConflictError)
+	if err != nil && !conflicted {
+		return err
+	}
+
+	if *out == "" {
+		*out = args[0]
+	}
+	if err := jsonstore.SaveAndRename(merged, *out); err != nil {
+		return err
+	}
+	if conflicted {
+		for _, c := range cerr.Conflicts {
+			fmt.Fprintf(stderr, "conflict: %s: ours %s, theirs %s\n", c.Key, orMissing(c.Ours), orMissing(c.Theirs))
+		}
+		return fmt.Errorf("%d conflicts are not resolved; our values are kept", len(cerr.Conflicts))
+	}
+	return nil
+}
+
+func orMissing(v []byte) string {
+	if v == nil {
+		return "(missing)"
+	}
+	return string(v)
+}
@@ -0,0 +1,208 @@
+// Command jsonstore inspects and edits the files of jsonstore.
+//
+// Usage:
+//
+//	jsonstore get FILE KEY
+//	jsonstore set FILE [-string] KEY [VALUE]
+//	jsonstore del FILE KEY...
+//	jsonstore keys FILE [-regex] [PATTERN]
+//	jsonstore count FILE [-regex] [PATTERN]
+//	jsonstore dump FILE [-compact]
+//	jsonstore validate FILE [-schema SCHEMA] [-prefix PREFIX | -pattern PATTERN]
+//	jsonstore compact FILE
+//	jsonstore convert SRC DST
+//	jsonstore salvage SRC DST
+//	jsonstore diff A B [-json]
+//	jsonstore merge BASE OURS THEIRS [-o OUT] [-prefer ours|theirs] [-objects]
+//	jsonstore repl FILE
+//
+// Files whose names end with ".gz" are gzipped.
+// convert reads and writes JSON Lines of {"key": KEY, "value": VALUE} for the files whose names end with ".jsonl".
+// The files are written by jsonstore.SaveAndRename, so an edit is never half written.
+// PATTERN is a glob of path.Match, or a regular expression with -regex.
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+const usage = `usage: jsonstore COMMAND FILE [ARGS...]
+
+commands:
+  get FILE KEY                    print the value of KEY
+  set FILE [-string] KEY [VALUE]  set a JSON value, read from stdin if VALUE is omitted
+  del FILE KEY...                 delete keys
+  keys FILE [-regex] [PATTERN]    list the keys matching PATTERN
+  count FILE [-regex] [PATTERN]   count the keys matching PATTERN
+  dump FILE [-compact]            print the whole store
+  validate FILE [-schema SCHEMA] [-prefix PREFIX | -pattern PATTERN]
+                                  check the file, and validate the values against SCHEMA
+  compact FILE                    rewrite the file in the compact form
+  convert SRC DST                 convert SRC into the format of DST (.json, .gz or .jsonl)
+  salvage SRC DST                 write the readable entries of a broken SRC to DST; exit 1 if SRC is broken
+  diff A B [-json]                print the differences from A to B; exit 1 if they differ
+  merge BASE OURS THEIRS [-o OUT] [-prefer ours|theirs] [-objects]
+                                  merge the changes of OURS and THEIRS, and write OUT (OURS by default)
+  repl FILE                       edit the file interactively
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command line, and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) < 2 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	name, filename, args := args[0], args[1], args[2:]
+
+	var err error
+	switch name {
+	case "compact":
+		err = compact(filename)
+	case "convert":
+		if len(args) != 1 {
+			fmt.Fprint(stderr, usage)
+			return 2
+		}
+		err = convert(filename, args[0])
+	case "salvage":
+		if len(args) != 1 {
+			fmt.Fprint(stderr, usage)
+			return 2
+		}
+		return salvage(filename, args[0], stderr)
+	case "diff":
+		return diff(filename, args, stdout, stderr)
+	case "merge":
+		err = merge(filename, args, stderr)
+	case "repl":
+		err = repl(filename, stdin, stdout)
+	default:
+		cmd, ok := commands[name]
+		if !ok {
+			fmt.Fprintf(stderr, "jsonstore: unknown command %q\n", name)
+			fmt.Fprint(stderr, usage)
+			return 2
+		}
+		err = runCommand(cmd, filename, args, stdin, stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "jsonstore:", err)
+		return 1
+	}
+	return 0
+}
+
+// runCommand runs cmd against the store in filename, and saves it if it is modified.
+func runCommand(cmd command, filename string, args []string, stdin io.Reader, stdout io.Writer) error {
+	ks, err := openStore(filename, cmd.create)
+	if err != nil {
+		return err
+	}
+	modified, err := cmd.fn(ks, args, stdin, stdout)
+	if modified {
+		if serr := jsonstore.SaveAndRename(ks, filename); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// openStore opens filename. If create is true, a missing file is an empty store.
+func openStore(filename string, create bool) (*jsonstore.JSONStore, error) {
+	ks, err := jsonstore.OpenFile(filename, jsonstore.Options{})
+	if os.IsNotExist(err) && create {
+		return new(jsonstore.JSONStore), nil
+	}
+	return ks, err
+}
+
+func compact(filename string) error {
+	ks, err := jsonstore.OpenFile(filename, jsonstore.Options{})
+	if err != nil {
+		return err
+	}
+	return jsonstore.SaveAndRename(ks, filename)
+}
+
+func convert(src, dst string) error {
+	var ks *jsonstore.JSONStore
+	var err error
+	if isJSONL(src) {
+		ks, err = openJSONL(src)
+	} else {
+		ks, err = jsonstore.OpenFile(src, jsonstore.Options{})
+	}
+	if err != nil {
+		return err
+	}
+	if isJSONL(dst) {
+		return saveJSONL(ks, dst)
+	}
+	return jsonstore.SaveAndRename(ks, dst)
+}
+
+func salvage(src, dst string, stderr io.Writer) int {
+	ks, err := jsonstore.Salvage(src)
+	if ks == nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := jsonstore.SaveAndRename(ks, dst); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		fmt.Fprintf(stderr, "%d entries are salvaged\n", ks.Size())
+		return 1
+	}
+	return 0
+}
+
+func isJSONL(filename string) bool {
+	return strings.HasSuffix(filename, ".jsonl")
+}
+
+func openJSONL(filename string) (*jsonstore.JSONStore, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ks := new(jsonstore.JSONStore)
+	result, err := ks.ImportJSONL(f, jsonstore.JSONLOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Errors) > 0 {
+		return nil, result.Errors[0]
+	}
+	return ks, nil
+}
+
+func saveJSONL(ks *jsonstore.JSONStore, filename string) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := ks.ExportJSONL(f, jsonstore.JSONLOptions{}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
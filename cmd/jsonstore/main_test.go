@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+// runString runs the command line, and returns the exit status and the outputs.
+func runString(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func setupFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "store.json.gz")
+	ks := new(jsonstore.JSONStore)
+	ks.SetRaw("human:1", []byte(`{"Name":"Dante","Height":5.4}`))
+	ks.SetRaw("human:2", []byte(`{"Name":"Virgil","Height":5.8}`))
+	ks.SetRaw("dog:1", []byte(`"Cerberus"`))
+	if err := jsonstore.Save(ks, filename); err != nil {
+		t.Fatal(err)
+	}
+	return filename, func() { os.RemoveAll(dir) }
+}
+
+func TestGetSetDel(t *testing.T) {
+	filename, cleanup := setupFile(t)
+	defer cleanup()
+
+	code, out, _ := runString("", "get", filename, "human:1")
+	if code != 0 {
+		t.Fatalf("want 0, got %d", code)
+	}
+	if want := "{\n  \"Name\": \"Dante\",\n  \"Height\": 5.4\n}\n"; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	if code, _, errOut := runString("", "get", filename, "human:3"); code != 1 || !strings.Contains(errOut, "no such key") {
+		t.Errorf("want no such key error, got %d %q", code, errOut)
+	}
+
+	if code, _, errOut := runString("", "set", filename, "human:3", `{"Name":"Beatrice"}`); code != 0 {
+		t.Fatalf("want 0, got %d: %s", code, errOut)
+	}
+	if code, _, _ := runString("hello\n", "set", filename, "-string", "greeting"); code != 0 {
+		t.Fatalf("want 0, got %d", code)
+	}
+	if code, _, errOut := runString("", "set", filename, "bad", "not json"); code != 1 || !strings.Contains(errOut, "-string") {
+		t.Errorf("want invalid JSON error, got %d %q", code, errOut)
+	}
+
+	ks, err := jsonstore.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if err := ks.Get("greeting", &s); err != nil || s != "hello" {
+		t.Errorf("want hello, got %q, %v", s, err)
+	}
+	if ks.Size() != 5 {
+		t.Errorf("want 5, got %d", ks.Size())
+	}
+
+	if code, _, _ := runString("", "del", filename, "human:3", "greeting", "missing"); code != 1 {
+		t.Errorf("want 1 for the missing key, got %d", code)
+	}
+	if _, out, _ := runString("", "count", filename); out != "3\n" {
+		t.Errorf("want 3, got %q", out)
+	}
+}
+
+func TestSetNewFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "new.json")
+
+	if code, _, _ := runString("", "get", filename, "hello"); code != 1 {
+		t.Errorf("want 1, got %d", code)
+	}
+	if code, _, _ := runString("", "set", filename, "hello", `"world"`); code != 0 {
+		t.Errorf("want 0, got %d", code)
+	}
+	b, _ := ioutil.ReadFile(filename)
+	if !strings.HasPrefix(string(b), `{"hello":"world"}`+"\n") {
+		t.Errorf("unexpected file: %s", b)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	filename, cleanup := setupFile(t)
+	defer cleanup()
+
+	if _, out, _ := runString("", "keys", filename); out != "dog:1\nhuman:1\nhuman:2\n" {
+		t.Errorf("unexpected keys: %q", out)
+	}
+	if _, out, _ := runString("", "keys", filename, "human:*"); out != "human:1\nhuman:2\n" {
+		t.Errorf("unexpected keys: %q", out)
+	}
+	if _, out, _ := runString("", "keys", filename, "-regex", `:1$`); out != "dog:1\nhuman:1\n" {
+		t.Errorf("unexpected keys: %q", out)
+	}
+	if _, out, _ := runString("", "count", filename, "-regex", "^human"); out != "2\n" {
+		t.Errorf("want 2, got %q", out)
+	}
+	if code, _, _ := runString("", "keys", filename, "[", ""); code != 1 {
+		t.Errorf("want 1, got %d", code)
+	}
+}
+
+func TestDumpConvert(t *testing.T) {
+	filename, cleanup := setupFile(t)
+	defer cleanup()
+
+	_, out, _ := runString("", "dump", filename, "-compact")
+	want := `{"dog:1":"Cerberus","human:1":{"Name":"Dante","Height":5.4},"human:2":{"Name":"Virgil","Height":5.8}}` + "\n"
+	if out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	plain := filepath.Join(filepath.Dir(filename), "store.json")
+	if code, _, errOut := runString("", "convert", filename, plain); code != 0 {
+		t.Fatalf("want 0, got %d: %s", code, errOut)
+	}
+	ks, err := jsonstore.Open(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.Size() != 3 {
+		t.Errorf("want 3, got %d", ks.Size())
+	}
+
+	jsonl := filepath.Join(filepath.Dir(filename), "store.jsonl")
+	if code, _, errOut := runString("", "convert", plain, jsonl); code != 0 {
+		t.Fatalf("want 0, got %d: %s", code, errOut)
+	}
+	if b, _ := ioutil.ReadFile(jsonl); !strings.Contains(string(b), `{"key":"dog:1","value":"Cerberus"}`+"\n") {
+		t.Errorf("unexpected JSON Lines: %s", b)
+	}
+	if code, _, errOut := runString("", "convert", jsonl, plain); code != 0 {
+		t.Fatalf("want 0, got %d: %s", code, errOut)
+	}
+	if _, out, _ := runString("", "dump", plain, "-compact"); out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	ioutil.WriteFile(plain, []byte("{\n  \"a\": [1, 2]\n}\n"), 0644)
+	if code, _, _ := runString("", "compact", plain); code != 0 {
+		t.Fatalf("want 0, got %d", code)
+	}
+	if b, _ := ioutil.ReadFile(plain); !strings.HasPrefix(string(b), `{"a":[1,2]}`) {
+		t.Errorf("unexpected file: %s", b)
+	}
+}
+
+func TestSalvage(t *testing.T) {
+	filename, cleanup := setupFile(t)
+	defer cleanup()
+	broken := filepath.Join(filepath.Dir(filename), "broken.json")
+	salvaged := filepath.Join(filepath.Dir(filename), "salvaged.json")
+
+	ioutil.WriteFile(broken, []byte(`{"a":1,"b":[1,2`), 0644)
+	code, _, errOut := runString("", "salvage", broken, salvaged)
+	if code != 1 || !strings.Contains(errOut, "1 entries are salvaged") {
+		t.Errorf("want 1, got %d: %s", code, errOut)
+	}
+	if _, out, _ := runString("", "dump", salvaged, "-compact"); out != `{"a":1}`+"\n" {
+		t.Errorf("want %q, got %q", `{"a":1}`, out)
+	}
+
+	if code, _, errOut := runString("", "salvage", filename, salvaged); code != 0 {
+		t.Errorf("want 0, got %d: %s", code, errOut)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	filename, cleanup := setupFile(t)
+	defer cleanup()
+	schema := filepath.Join(filepath.Dir(filename), "schema.json")
+	ioutil.WriteFile(schema, []byte(`{"type": "object", "properties": {"Height": {"maximum": 5.5}}}`), 0644)
+
+	if code, out, _ := runString("", "validate", filename); code != 0 || out != "ok\n" {
+		t.Errorf("want ok, got %d %q", code, out)
+	}
+	code, out, _ := runString("", "validate", filename, "-schema", schema, "-prefix", "human:")
+	if code != 1 {
+		t.Errorf("want 1, got %d", code)
+	}
+	if out != "human:2: /Height: 5.8 is greater than maximum 5.5\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	broken := filepath.Join(filepath.Dir(filename), "broken.json")
+	ioutil.WriteFile(broken, []byte(`{"a":`), 0644)
+	if code, _, _ := runString("", "validate", broken); code != 1 {
+		t.Errorf("want 1, got %d", code)
+	}
+}
+
+func TestREPL(t *testing.T) {
+	filename, cleanup := setupFile(t)
+	defer cleanup()
+
+	input := strings.Join([]string{
+		"help",
+		`set human:3 {"Name": "Beatrice", "Height": 5.2}`,
+		"set -string greeting hello, world",
+		"get greeting",
+		"del dog:1",
+		"count",
+		"quit",
+		"save",
+		"unknown",
+		"quit",
+	}, "\n")
+	code, out, errOut := runString(input, "repl", filename)
+	if code != 0 {
+		t.Fatalf("want 0, got %d: %s", code, errOut)
+	}
+	for _, want := range []string{`"hello, world"`, "> 4\n", "not saved", "unknown command"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want %q in the output, got %q", want, out)
+		}
+	}
+
+	ks, err := jsonstore.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.Size() != 4 {
+		t.Errorf("want 4, got %d", ks.Size())
+	}
+
+	// EOF with unsaved changes
+	if code, _, _ := runString("del human:1\n", "repl", filename); code != 1 {
+		t.Errorf("want 1, got %d", code)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if code, _, errOut := runString(""); code != 2 || !strings.Contains(errOut, "usage") {
+		t.Errorf("want usage, got %d %q", code, errOut)
+	}
+	if code, _, _ := runString("", "unknown", "file"); code != 2 {
+		t.Errorf("want 2, got %d", code)
+	}
+}
+
+func TestDiffMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, data string) string {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	base := write("base.json", `{"a":1,"b":1,"c":1}`)
+	ours := write("ours.json", `{"a":2,"b":1,"c":2}`)
+	theirs := write("theirs.json", `{"a":1,"b":2,"c":3}`)
+
+	code, out, _ := runString("", "diff", base, ours)
+	if code != 1 {
+		t.Errorf("want 1, got %d", code)
+	}
+	if want := "~ a\n    ~ /: 1 -> 2\n~ c\n    ~ /: 1 -> 2\n"; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+	if code, _, _ := runString("", "diff", base, base, "-json"); code != 0 {
+		t.Errorf("want 0, got %d", code)
+	}
+
+	merged := filepath.Join(dir, "merged.json")
+	code, _, errOut := runString("", "merge", base, ours, theirs, "-o", merged)
+	if code != 1 || !strings.Contains(errOut, "conflict: c: ours 2, theirs 3") {
+		t.Errorf("want conflict, got %d %q", code, errOut)
+	}
+	if b, _ := ioutil.ReadFile(merged); !strings.HasPrefix(string(b), `{"a":2,"b":2,"c":2}`) {
+		t.Errorf("unexpected merged file: %s", b)
+	}
+
+	if code, _, errOut := runString("", "merge", base, ours, theirs, "-prefer", "theirs"); code != 0 {
+		t.Errorf("want 0, got %d: %s", code, errOut)
+	}
+	if b, _ := ioutil.ReadFile(ours); !strings.HasPrefix(string(b), `{"a":2,"b":2,"c":3}`) {
+		t.Errorf("unexpected merged file: %s", b)
+	}
+}
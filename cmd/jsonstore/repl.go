@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+const replHelp = `commands:
+  get KEY                    print the value of KEY
+  set [-string] KEY VALUE    set a value; VALUE is the rest of the line
+  del KEY...                 delete keys
+  keys [-regex] [PATTERN]    list the keys matching PATTERN
+  count [-regex] [PATTERN]   count the keys matching PATTERN
+  dump [-compact]            print the whole store
+  validate [-schema SCHEMA] [-prefix PREFIX | -pattern PATTERN]
+  save                       save the changes
+  quit                       quit; use quit! to discard the changes
+`
+
+var errUnsaved = errors.New("the changes are not saved")
+
+// repl edits filename interactively.
+// The changes are kept in memory until save is executed.
+func repl(filename string, stdin io.Reader, stdout io.Writer) error {
+	ks, err := openStore(filename, true)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	modified := false
+	for {
+		fmt.Fprint(stdout, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(stdout)
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			if modified {
+				return errUnsaved
+			}
+			return nil
+		}
+		line := strings.TrimSpace(scanner.Text())
+		name, rest := splitWord(line)
+		switch name {
+		case "":
+			continue
+		case "help":
+			fmt.Fprint(stdout, replHelp)
+			continue
+		case "save":
+			if err := jsonstore.SaveAndRename(ks, filename); err != nil {
+				fmt.Fprintln(stdout, "error:", err)
+				continue
+			}
+			modified = false
+			continue
+		case "quit", "exit":
+			if modified {
+				fmt.Fprintln(stdout, "error: the changes are not saved; use save, or quit! to discard them")
+				continue
+			}
+			return nil
+		case "quit!", "exit!":
+			return nil
+		}
+
+		cmd, ok := commands[name]
+		if !ok {
+			fmt.Fprintf(stdout, "error: unknown command %q; try help\n", name)
+			continue
+		}
+		args, err := replArgs(name, rest)
+		if err != nil {
+			fmt.Fprintln(stdout, "error:", err)
+			continue
+		}
+		m, err := cmd.fn(ks, args, strings.NewReader(""), stdout)
+		modified = modified || m
+		if err != nil {
+			fmt.Fprintln(stdout, "error:", err)
+		}
+	}
+}
+
+// replArgs splits the arguments of a command.
+// The value of set is the rest of the line, so it may contain spaces.
+func replArgs(name, rest string) ([]string, error) {
+	if name != "set" {
+		return strings.Fields(rest), nil
+	}
+	var args []string
+	word, rest := splitWord(rest)
+	if word == "-string" {
+		args = append(args, word)
+		word, rest = splitWord(rest)
+	}
+	if word == "" || rest == "" {
+		return nil, errors.New("usage: set [-string] KEY VALUE")
+	}
+	return append(args, word, rest), nil
+}
+
+// splitWord splits s into the first word and the rest.
+func splitWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i+1:])
+}
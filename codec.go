@@ -0,0 +1,89 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// Codec encodes and decodes JSON for a JSONStore.
+// Codec is used by Set and Get for values, and by Open and Save for files.
+type Codec interface {
+	// Marshal returns the JSON encoding of v.
+	Marshal(v interface{}, opts EncodeOptions) ([]byte, error)
+
+	// Unmarshal parses the JSON-encoded data and stores the result in the value pointed to by v.
+	// DecodeOptions.Unmarshalers is handled by JSONStore, so the codec may ignore it.
+	Unmarshal(data []byte, v interface{}, opts DecodeOptions) error
+
+	// NewEncoder returns a new encoder that writes to w.
+	NewEncoder(w io.Writer) Encoder
+
+	// NewDecoder returns a new decoder that reads from r.
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Encoder writes JSON values to an output stream.
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder reads JSON values from an input stream.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// StdCodec is a Codec using encoding/json.
+type StdCodec struct{}
+
+// DefaultCodec is the Codec used when no codec is set.
+var DefaultCodec Codec = StdCodec{}
+
+// Marshal implements Codec.
+func (StdCodec) Marshal(v interface{}, opts EncodeOptions) ([]byte, error) {
+	if opts.isZero() {
+		return json.Marshal(v)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(!opts.DisableHTMLEscape)
+	enc.SetIndent(opts.Prefix, opts.Indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	// json.Encoder terminates each value with a newline.
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+// Unmarshal implements Codec.
+func (StdCodec) Unmarshal(data []byte, v interface{}, opts DecodeOptions) error {
+	if !opts.UseNumber && !opts.DisallowUnknownFields {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if opts.UseNumber {
+		dec.UseNumber()
+	}
+	if opts.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(v)
+}
+
+// NewEncoder implements Codec.
+func (StdCodec) NewEncoder(w io.Writer) Encoder {
+	return json.NewEncoder(w)
+}
+
+// NewDecoder implements Codec.
+func (StdCodec) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+// SetCodec sets the codec of the store.
+// If c is nil, DefaultCodec is used.
+func (s *JSONStore) SetCodec(c Codec) {
+	s.updateConfig(func(cfg *config) {
+		cfg.codec = c
+	})
+}
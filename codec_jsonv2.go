@@ -0,0 +1,62 @@
+//go:build goexperiment.jsonv2
+
+package jsonstore
+
+import (
+	"encoding/json/jsontext"
+	jsonv2 "encoding/json/v2"
+	"io"
+)
+
+// JSONv2Codec is a Codec using encoding/json/v2.
+// It is available when building with GOEXPERIMENT=jsonv2.
+//
+// encoding/json/v2 has no equivalent of DecodeOptions.UseNumber,
+// so JSONv2Codec falls back to StdCodec when it is set.
+type JSONv2Codec struct{}
+
+// Marshal implements Codec.
+func (JSONv2Codec) Marshal(v interface{}, opts EncodeOptions) ([]byte, error) {
+	o := []jsonv2.Options{jsontext.EscapeForHTML(!opts.DisableHTMLEscape)}
+	if opts.Indent != "" {
+		o = append(o, jsontext.WithIndent(opts.Indent))
+	}
+	if opts.Prefix != "" {
+		o = append(o, jsontext.WithIndentPrefix(opts.Prefix))
+	}
+	return jsonv2.Marshal(v, o...)
+}
+
+// Unmarshal implements Codec.
+func (JSONv2Codec) Unmarshal(data []byte, v interface{}, opts DecodeOptions) error {
+	if opts.UseNumber {
+		return StdCodec{}.Unmarshal(data, v, opts)
+	}
+	return jsonv2.Unmarshal(data, v, jsonv2.RejectUnknownMembers(opts.DisallowUnknownFields))
+}
+
+// NewEncoder implements Codec.
+func (JSONv2Codec) NewEncoder(w io.Writer) Encoder {
+	return jsonv2Encoder{jsontext.NewEncoder(w)}
+}
+
+// NewDecoder implements Codec.
+func (JSONv2Codec) NewDecoder(r io.Reader) Decoder {
+	return jsonv2Decoder{jsontext.NewDecoder(r)}
+}
+
+type jsonv2Encoder struct {
+	enc *jsontext.Encoder
+}
+
+func (e jsonv2Encoder) Encode(v interface{}) error {
+	return jsonv2.MarshalEncode(e.enc, v)
+}
+
+type jsonv2Decoder struct {
+	dec *jsontext.Decoder
+}
+
+func (d jsonv2Decoder) Decode(v interface{}) error {
+	return jsonv2.UnmarshalDecode(d.dec, v)
+}
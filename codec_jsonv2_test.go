@@ -0,0 +1,10 @@
+//go:build goexperiment.jsonv2
+
+package jsonstore
+
+func init() {
+	benchCodecs = append(benchCodecs, struct {
+		name  string
+		codec Codec
+	}{"jsonv2", JSONv2Codec{}})
+}
@@ -0,0 +1,119 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// benchCodecs is the list of codecs used by BenchmarkGet and BenchmarkSet.
+var benchCodecs = []struct {
+	name  string
+	codec Codec
+}{
+	{"std", StdCodec{}},
+}
+
+type countingCodec struct {
+	StdCodec
+	marshal, unmarshal, encode, decode int
+}
+
+func (c *countingCodec) Marshal(v interface{}, opts EncodeOptions) ([]byte, error) {
+	c.marshal++
+	return c.StdCodec.Marshal(v, opts)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v interface{}, opts DecodeOptions) error {
+	c.unmarshal++
+	return c.StdCodec.Unmarshal(data, v, opts)
+}
+
+func (c *countingCodec) NewEncoder(w io.Writer) Encoder {
+	c.encode++
+	return c.StdCodec.NewEncoder(w)
+}
+
+func (c *countingCodec) NewDecoder(r io.Reader) Decoder {
+	c.decode++
+	return c.StdCodec.NewDecoder(r)
+}
+
+func TestCodec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "foo.json.gz")
+
+	c := &countingCodec{}
+	ks := new(JSONStore)
+	ks.SetCodec(c)
+	if err := ks.Set("human:1", Human{"Dante", 5.4}); err != nil {
+		t.Fatal(err)
+	}
+	var human Human
+	if err := ks.Get("human:1", &human); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAndRename(ks, name); err != nil {
+		t.Fatal(err)
+	}
+	if c.marshal != 1 || c.unmarshal != 1 || c.encode != 1 {
+		t.Errorf("unexpected count: %+v", *c)
+	}
+
+	ks2, err := OpenFile(name, Options{Codec: c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.decode != 1 {
+		t.Errorf("want 1, got %d", c.decode)
+	}
+	if err := ks2.Get("human:1", &human); err != nil {
+		t.Fatal(err)
+	}
+	if human.Name != "Dante" {
+		t.Errorf("want Dante, got %s", human.Name)
+	}
+	if c.unmarshal != 2 {
+		t.Errorf("want 2, got %d", c.unmarshal)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	for _, bc := range benchCodecs {
+		bc := bc
+		t.Run(bc.name, func(t *testing.T) {
+			ks := new(JSONStore)
+			ks.SetCodec(bc.codec)
+			if err := ks.Set("html", "<&>"); err != nil {
+				t.Fatal(err)
+			}
+			if b, _ := ks.GetRaw("html"); string(b) != `"\u003c\u0026\u003e"` {
+				t.Errorf("unexpected encoding: %s", b)
+			}
+			if err := ks.SetWithOptions("human:1", Human{"Dante", 5.4}, EncodeOptions{DisableHTMLEscape: true, Indent: "\t"}); err != nil {
+				t.Fatal(err)
+			}
+			if b, _ := ks.GetRaw("human:1"); string(b) != "{\n\t\"Name\": \"Dante\",\n\t\"Height\": 5.4\n}" {
+				t.Errorf("unexpected encoding: %q", b)
+			}
+			var v map[string]interface{}
+			if err := ks.GetWithOptions("human:1", &v, DecodeOptions{UseNumber: true}); err != nil {
+				t.Fatal(err)
+			}
+			if v["Height"] != json.Number("5.4") {
+				t.Errorf("want json.Number, got %#v", v["Height"])
+			}
+			var s struct{ Name string }
+			if err := ks.GetWithOptions("human:1", &s, DecodeOptions{DisallowUnknownFields: true}); err == nil {
+				t.Error("want error, got nil")
+			}
+		})
+	}
+}
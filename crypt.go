@@ -0,0 +1,406 @@
+package jsonstore
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	// ErrWrongKey is returned when encrypted data is decrypted with wrong keys or without keys.
+	ErrWrongKey = errors.New("jsonstore: wrong encryption key")
+
+	// ErrCorrupt is returned when encrypted data is broken, truncated or tampered with.
+	ErrCorrupt = errors.New("jsonstore: encrypted data is corrupt")
+
+	// ErrNotEncrypted is returned when a file opened with keys is not encrypted.
+	ErrNotEncrypted = errors.New("jsonstore: file is not encrypted")
+)
+
+// KeySize is the size of the keys for NewKey.
+const KeySize = 32
+
+// The format of encrypted files:
+//
+//	magic       [4]byte  "JSE\x00"
+//	version     uint8    1
+//	kdf         uint8    kdfNone or kdfScrypt
+//	logN, r, p  uint8    the parameters of scrypt
+//	kdfSalt     [16]byte the salt of scrypt
+//	fileSalt    [16]byte the salt of HKDF, which is random for each file
+//	chunkSize   uint32   the size of the plaintext of the chunks
+//	check       [32]byte the key check value derived by HKDF
+//	chunks...
+//
+// The chunks are sealed by AES-256-GCM with the header as the additional data.
+// The nonce of a chunk is its sequence number, and the last byte of the nonce is 1 for the last chunk,
+// so a truncation at the boundary of chunks is detected.
+const (
+	encMagic      = "JSE\x00"
+	encVersion    = 1
+	encSaltSize   = 16
+	encCheckSize  = 32
+	encHeaderSize = len(encMagic) + 5 + 2*encSaltSize + 4 + encCheckSize
+	encChunkSize  = 64 * 1024
+	encMaxChunk   = 16 * 1024 * 1024
+
+	kdfNone   = 0
+	kdfScrypt = 1
+
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+
+	// the limits of the parameters read from the headers.
+	scryptMaxLogN   = 20
+	scryptMaxRP     = 64
+	scryptMaxMemory = 1 << 30
+)
+
+// Key is a key to encrypt store files and fields of values.
+// A Key is safe for concurrent use.
+type Key struct {
+	raw        []byte
+	passphrase []byte
+
+	mu      sync.Mutex
+	derived map[scryptParams][]byte
+	current *scryptParams // the parameters for encryption
+}
+
+type scryptParams struct {
+	logN, r, p uint8
+	salt       [encSaltSize]byte
+}
+
+// valid reports whether the parameters are within the limits.
+// The parameters come from the headers, which are not authenticated until the key is derived,
+// so they are limited to keep a crafted file from using too much memory and time.
+func (params scryptParams) valid() bool {
+	if params.logN == 0 || params.logN > scryptMaxLogN || params.r == 0 || params.p == 0 {
+		return false
+	}
+	return int(params.r)*int(params.p) <= scryptMaxRP && 128*int(params.r)<<params.logN <= scryptMaxMemory
+}
+
+// NewKey returns a Key of AES-256. key must be KeySize bytes.
+func NewKey(key []byte) (*Key, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("jsonstore: invalid key size")
+	}
+	return &Key{raw: append([]byte(nil), key...)}, nil
+}
+
+// NewPassphraseKey returns a Key derived from passphrase by scrypt.
+// The derivation is slow by design, so the derived keys are cached in the Key.
+func NewPassphraseKey(passphrase string) *Key {
+	return &Key{
+		passphrase: []byte(passphrase),
+		derived:    map[scryptParams][]byte{},
+	}
+}
+
+// master returns the key for the parameters.
+func (k *Key) master(params scryptParams) ([]byte, error) {
+	if k.raw != nil {
+		return k.raw, nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if b, ok := k.derived[params]; ok {
+		return b, nil
+	}
+	if !params.valid() {
+		return nil, ErrCorrupt
+	}
+	b, err := scrypt.Key(k.passphrase, params.salt[:], 1<<params.logN, int(params.r), int(params.p), KeySize)
+	if err != nil {
+		return nil, err
+	}
+	k.derived[params] = b
+	return b, nil
+}
+
+// encryptionParams returns the parameters for encryption.
+// A passphrase Key uses the same salt of scrypt for all files, so it doesn't derive the key every time.
+func (k *Key) encryptionParams() (scryptParams, error) {
+	if k.raw != nil {
+		return scryptParams{}, nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.current == nil {
+		params := scryptParams{logN: scryptLogN, r: scryptR, p: scryptP}
+		if _, err := io.ReadFull(rand.Reader, params.salt[:]); err != nil {
+			return scryptParams{}, err
+		}
+		k.current = &params
+	}
+	return *k.current, nil
+}
+
+// encHeader is the header of an encrypted file.
+type encHeader struct {
+	kdf       uint8
+	params    scryptParams
+	fileSalt  [encSaltSize]byte
+	chunkSize uint32
+	check     [encCheckSize]byte
+}
+
+func (h *encHeader) marshal() []byte {
+	b := make([]byte, 0, encHeaderSize)
+	b = append(b, encMagic...)
+	b = append(b, encVersion, h.kdf, h.params.logN, h.params.r, h.params.p)
+	b = append(b, h.params.salt[:]...)
+	b = append(b, h.fileSalt[:]...)
+	b = binary.BigEndian.AppendUint32(b, h.chunkSize)
+	b = append(b, h.check[:]...)
+	return b
+}
+
+func (h *encHeader) unmarshal(b []byte) error {
+	if len(b) != encHeaderSize || string(b[:len(encMagic)]) != encMagic {
+		return ErrNotEncrypted
+	}
+	b = b[len(encMagic):]
+	if b[0] != encVersion {
+		return ErrCorrupt
+	}
+	h.kdf = b[1]
+	if h.kdf != kdfNone && h.kdf != kdfScrypt {
+		return ErrCorrupt
+	}
+	h.params.logN, h.params.r, h.params.p = b[2], b[3], b[4]
+	if h.kdf == kdfScrypt && !h.params.valid() {
+		return ErrCorrupt
+	}
+	b = b[5:]
+	b = b[copy(h.params.salt[:], b):]
+	b = b[copy(h.fileSalt[:], b):]
+	h.chunkSize = binary.BigEndian.Uint32(b)
+	if h.chunkSize == 0 || h.chunkSize > encMaxChunk {
+		return ErrCorrupt
+	}
+	copy(h.check[:], b[4:])
+	return nil
+}
+
+// fileKey derives the key of the file and the key check value.
+func (h *encHeader) fileKey(master []byte) (cipher.AEAD, [encCheckSize]byte, error) {
+	var check [encCheckSize]byte
+	r := hkdf.New(sha256.New, master, h.fileSalt[:], []byte("jsonstore file encryption"))
+	var key [KeySize]byte
+	if _, err := io.ReadFull(r, key[:]); err != nil {
+		return nil, check, err
+	}
+	if _, err := io.ReadFull(r, check[:]); err != nil {
+		return nil, check, err
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, check, err
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, check, err
+}
+
+func encNonce(aead cipher.AEAD, counter uint64, last bool) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce, counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// encryptWriter encrypts the data written to it.
+// Close MUST be called to write the last chunk.
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	ad      []byte
+	buf     []byte
+	out     []byte
+	counter uint64
+}
+
+func newEncryptWriter(w io.Writer, key *Key) (*encryptWriter, error) {
+	h := encHeader{chunkSize: encChunkSize}
+	params, err := key.encryptionParams()
+	if err != nil {
+		return nil, err
+	}
+	if key.raw == nil {
+		h.kdf = kdfScrypt
+		h.params = params
+	}
+	if _, err := io.ReadFull(rand.Reader, h.fileSalt[:]); err != nil {
+		return nil, err
+	}
+	master, err := key.master(params)
+	if err != nil {
+		return nil, err
+	}
+	aead, check, err := h.fileKey(master)
+	if err != nil {
+		return nil, err
+	}
+	h.check = check
+	header := h.marshal()
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:    w,
+		aead: aead,
+		ad:   header,
+		buf:  make([]byte, 0, encChunkSize),
+		out:  make([]byte, 0, encChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// the full chunk is written when more data comes, because the last chunk is sealed differently.
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (w *encryptWriter) flush(last bool) error {
+	w.out = w.aead.Seal(w.out[:0], encNonce(w.aead, w.counter, last), w.buf, w.ad)
+	w.counter++
+	w.buf = w.buf[:0]
+	_, err := w.w.Write(w.out)
+	return err
+}
+
+// Close writes the last chunk. It doesn't close the underlying writer.
+func (w *encryptWriter) Close() error {
+	return w.flush(true)
+}
+
+// decryptReader decrypts the data read from an encrypted file.
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	ad      []byte
+	in      []byte
+	buf     []byte
+	counter uint64
+	done    bool
+	err     error
+}
+
+// newDecryptReader reads the header from r, and returns the reader of the plaintext.
+// It tries keys in order, and returns ErrWrongKey if none of them matches.
+func newDecryptReader(r *bufio.Reader, keys []*Key) (*decryptReader, error) {
+	header := make([]byte, encHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if bytes.HasPrefix(header, []byte(encMagic)) {
+			return nil, ErrCorrupt
+		}
+		return nil, ErrNotEncrypted
+	}
+	var h encHeader
+	if err := h.unmarshal(header); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if (key.raw == nil) != (h.kdf == kdfScrypt) {
+			continue
+		}
+		master, err := key.master(h.params)
+		if err != nil {
+			return nil, err
+		}
+		aead, check, err := h.fileKey(master)
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare(check[:], h.check[:]) == 1 {
+			return &decryptReader{
+				r:    r,
+				aead: aead,
+				ad:   header,
+				in:   make([]byte, int(h.chunkSize)+aead.Overhead()),
+			}, nil
+		}
+	}
+	return nil, ErrWrongKey
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.r, d.in)
+	last := false
+	switch err {
+	case nil:
+		if _, err := d.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+	plain, err := d.aead.Open(d.in[:0], encNonce(d.aead, d.counter, last), d.in[:n], d.ad)
+	if err != nil {
+		return ErrCorrupt
+	}
+	d.counter++
+	d.buf = plain
+	d.done = last
+	return nil
+}
+
+// isEncrypted reports whether r starts with the header of an encrypted file.
+func isEncrypted(r *bufio.Reader) bool {
+	b, _ := r.Peek(len(encMagic))
+	return string(b) == encMagic
+}
+
+// SetEncryptionKey sets the key to encrypt the files written by Save, SaveAndRename and auto saving.
+// If key is nil, the files are not encrypted.
+func (s *JSONStore) SetEncryptionKey(key *Key) {
+	s.updateConfig(func(c *config) {
+		c.key = key
+	})
+}
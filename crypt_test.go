@@ -0,0 +1,184 @@
+package jsonstore
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestKey(t *testing.T, b byte) *Key {
+	key, err := NewKey(bytes.Repeat([]byte{b}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := newTestKey(t, 1)
+	for _, name := range []string{"foo.jsonstore", "foo.jsonstore.gz"} {
+		filename := filepath.Join(dir, name)
+		ks := new(JSONStore)
+		ks.SetEncryptionKey(key)
+		// larger than a chunk
+		for i := 0; i < 10000; i++ {
+			ks.Set(fmt.Sprintf("token:%d", i), fmt.Sprintf("secret-%d", i))
+		}
+		if err := SaveAndRename(ks, filename); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(b, []byte("secret")) {
+			t.Errorf("%s: the file is not encrypted", name)
+		}
+
+		ks2, err := OpenFile(filename, Options{Keys: []*Key{key}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v string
+		if err := ks2.Get("token:9999", &v); err != nil || v != "secret-9999" {
+			t.Errorf("%s: want %q, got %q, %v", name, "secret-9999", v, err)
+		}
+		if ks2.Size() != 10000 {
+			t.Errorf("%s: want %d, got %d", name, 10000, ks2.Size())
+		}
+
+		if _, err := Open(filename); err != ErrWrongKey {
+			t.Errorf("%s: want %v, got %v", name, ErrWrongKey, err)
+		}
+		if _, err := OpenFile(filename, Options{Keys: []*Key{newTestKey(t, 2)}}); err != ErrWrongKey {
+			t.Errorf("%s: want %v, got %v", name, ErrWrongKey, err)
+		}
+	}
+}
+
+func TestEncryption_Corrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := newTestKey(t, 1)
+	filename := filepath.Join(dir, "foo.jsonstore")
+	ks := new(JSONStore)
+	ks.SetEncryptionKey(key)
+	for i := 0; i < 10000; i++ {
+		ks.Set(fmt.Sprintf("token:%d", i), fmt.Sprintf("secret-%d", i))
+	}
+	if err := Save(ks, filename); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		"flipped":   append([]byte(nil), b...),
+		"truncated": b[:len(b)-1],
+		// cut at the boundary of the chunks
+		"truncated chunk": b[:encHeaderSize+encChunkSize+16],
+		"header":          append([]byte(nil), b...),
+	}
+	tests["flipped"][len(b)-10] ^= 1
+	tests["header"][len(encMagic)+5+2*encSaltSize+3]++ // the chunk size is covered by the tags
+	for name, data := range tests {
+		ioutil.WriteFile(filename, data, 0644)
+		if _, err := OpenFile(filename, Options{Keys: []*Key{key}}); err != ErrCorrupt {
+			t.Errorf("%s: want %v, got %v", name, ErrCorrupt, err)
+		}
+	}
+
+	ioutil.WriteFile(filename, []byte(`{"hello":"world"}`), 0644)
+	if _, err := OpenFile(filename, Options{Keys: []*Key{key}}); err != ErrNotEncrypted {
+		t.Errorf("want %v, got %v", ErrNotEncrypted, err)
+	}
+}
+
+func TestEncryption_Rotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "foo.jsonstore")
+	oldKey := NewPassphraseKey("correct horse battery staple")
+	newKey := newTestKey(t, 3)
+
+	ks := new(JSONStore)
+	ks.SetEncryptionKey(oldKey)
+	ks.Set("hello", "world")
+	if err := Save(ks, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	// a passphrase key is derived from the salt in the file.
+	if _, err := OpenFile(filename, Options{Keys: []*Key{NewPassphraseKey("wrong")}}); err != ErrWrongKey {
+		t.Errorf("want %v, got %v", ErrWrongKey, err)
+	}
+
+	ks2, err := OpenFile(filename, Options{Keys: []*Key{newKey, oldKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAndRename(ks2, filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFile(filename, Options{Keys: []*Key{oldKey}}); err != ErrWrongKey {
+		t.Errorf("want %v, got %v", ErrWrongKey, err)
+	}
+	ks3, err := OpenFile(filename, Options{Keys: []*Key{newKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v string
+	if err := ks3.Get("hello", &v); err != nil || v != "world" {
+		t.Errorf("want %q, got %q, %v", "world", v, err)
+	}
+}
+
+func TestEncryption_ScryptLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "foo.jsonstore")
+	key := NewPassphraseKey("correct horse battery staple")
+	ks := new(JSONStore)
+	ks.SetEncryptionKey(key)
+	ks.Set("hello", "world")
+	if err := Save(ks, filename); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// logN, r and p are in the header, which is not authenticated before deriving the key.
+	for i, v := range []byte{30, 255, 255} {
+		data := append([]byte(nil), b...)
+		data[len(encMagic)+2+i] = v
+		ioutil.WriteFile(filename, data, 0644)
+		if _, err := OpenFile(filename, Options{Keys: []*Key{key}}); err != ErrCorrupt {
+			t.Errorf("%d: want %v, got %v", i, ErrCorrupt, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// CSVOptions is the options of ImportCSV.
+type CSVOptions struct {
+	// KeyColumn is the name of the column which has the key.
+	// The first line of the input must be the header.
+	KeyColumn string
+
+	// KeyPrefix is added to the keys.
+	KeyPrefix string
+
+	// Fields maps the column names to the field names of the values.
+	// If it is nil, all columns except the key column are used with their names.
+	// Otherwise, only the columns in Fields are used.
+	Fields map[string]string
+
+	// InferTypes converts the cells which look like JSON numbers, booleans or null into them,
+	// and the empty cells into null. Otherwise, all cells are strings.
+	InferTypes bool
+
+	// Comma is the field delimiter. Zero means ','.
+	Comma rune
+
+	// DryRun validates the records without saving them.
+	DryRun bool
+}
+
+type csvColumn struct {
+	index int
+	name  []byte // encoded field name
+}
+
+// ImportCSV imports CSV from r, which has a record in each row.
+// A record is saved as an object at the value of the key column.
+// The rows are read one by one, so the input is not loaded into memory at once.
+// The invalid rows are skipped, and they are reported in ImportResult.Errors.
+// The error is not nil if reading r fails or the header is invalid.
+func (s *JSONStore) ImportCSV(r io.Reader, opts CSVOptions) (ImportResult, error) {
+	var result ImportResult
+	if !opts.DryRun && s.getConfig().readOnly {
+		return result, ErrReadOnly
+	}
+	cr := csv.NewReader(r)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("jsonstore: no CSV header")
+		}
+		return result, err
+	}
+	keyIndex := -1
+	var columns []csvColumn
+	for i, name := range header {
+		if name == opts.KeyColumn && keyIndex < 0 {
+			keyIndex = i
+			continue
+		}
+		field := name
+		if opts.Fields != nil {
+			var ok bool
+			if field, ok = opts.Fields[name]; !ok {
+				continue
+			}
+		}
+		b, err := json.Marshal(field)
+		if err != nil {
+			return result, err
+		}
+		columns = append(columns, csvColumn{index: i, name: b})
+	}
+	if keyIndex < 0 {
+		return result, fmt.Errorf("jsonstore: no key column %q", opts.KeyColumn)
+	}
+
+	var buf bytes.Buffer
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			// a broken quote can't be skipped safely.
+			return result, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		if len(record) != len(header) {
+			result.Errors = append(result.Errors, &LineError{
+				Line: line,
+				Err:  fmt.Errorf("wrong number of fields: want %d, got %d", len(header), len(record)),
+			})
+			continue
+		}
+		key := record[keyIndex]
+		if key == "" {
+			result.Errors = append(result.Errors, &LineError{Line: line, Err: fmt.Errorf("empty key")})
+			continue
+		}
+		key = opts.KeyPrefix + key
+
+		buf.Reset()
+		buf.WriteByte('{')
+		for i, c := range columns {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(c.name)
+			buf.WriteByte(':')
+			if err := writeCSVValue(&buf, record[c.index], opts.InferTypes); err != nil {
+				return result, err
+			}
+		}
+		buf.WriteByte('}')
+		value := append([]byte(nil), buf.Bytes()...)
+
+		if err := s.importValue(key, value, opts.DryRun); err != nil {
+			result.Errors = append(result.Errors, &LineError{Line: line, Key: key, Err: err})
+			continue
+		}
+		result.Imported++
+	}
+}
+
+// writeCSVValue writes the JSON value of a cell.
+func writeCSVValue(buf *bytes.Buffer, cell string, inferTypes bool) error {
+	if inferTypes {
+		switch cell {
+		case "", "null":
+			buf.WriteString("null")
+			return nil
+		case "true", "false":
+			buf.WriteString(cell)
+			return nil
+		}
+		if isJSONNumber(cell) {
+			buf.WriteString(cell)
+			return nil
+		}
+	}
+	b, err := json.Marshal(cell)
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
+
+// isJSONNumber reports whether s is a number in JSON.
+// The numbers with leading zeros, such as zip codes, are not.
+func isJSONNumber(s string) bool {
+	if s == "" || (s[0] != '-' && (s[0] < '0' || s[0] > '9')) {
+		return false
+	}
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return false
+	}
+	return json.Valid([]byte(s))
+}
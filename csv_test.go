@@ -0,0 +1,91 @@
+package jsonstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportCSV(t *testing.T) {
+	in := "id,name,age,zip,admin,note\n" +
+		"1,Dante,30,01234,true,\n" +
+		"2,\"Smith, John\",-1.5e2,99999,false,null\n" +
+		"3,too,few\n" +
+		",no key,1,1,true,\n"
+	ks := newStoreFromJSON(t, `{}`)
+	result, err := ks.ImportCSV(strings.NewReader(in), CSVOptions{
+		KeyColumn:  "id",
+		KeyPrefix:  "user:",
+		InferTypes: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 2 {
+		t.Errorf("want %d, got %d", 2, result.Imported)
+	}
+	if len(result.Errors) != 2 {
+		t.Fatalf("want %d errors, got %v", 2, result.Errors)
+	}
+	if result.Errors[0].Line != 4 || result.Errors[1].Line != 5 {
+		t.Errorf("want lines 4 and 5, got %v", result.Errors)
+	}
+
+	want := map[string]string{
+		"user:1": `{"name":"Dante","age":30,"zip":"01234","admin":true,"note":null}`,
+		"user:2": `{"name":"Smith, John","age":-1.5e2,"zip":99999,"admin":false,"note":null}`,
+	}
+	if got := storeData(ks); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestImportCSV_Fields(t *testing.T) {
+	in := "name\tid\tage\n" +
+		"Dante\tdante\t30\n"
+	ks := newStoreFromJSON(t, `{}`)
+	_, err := ks.ImportCSV(strings.NewReader(in), CSVOptions{
+		KeyColumn: "id",
+		Fields:    map[string]string{"name": "Name"},
+		Comma:     '\t',
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"dante": `{"Name":"Dante"}`}
+	if got := storeData(ks); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if _, err := ks.ImportCSV(strings.NewReader(in), CSVOptions{KeyColumn: "key"}); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestImportCSV_DryRun(t *testing.T) {
+	in := "id,Name,Height\n" +
+		"1,Dante,5.4\n" +
+		"2,Virgil,-1\n"
+	ks := newStoreFromJSON(t, `{}`)
+	ks.RegisterSchemaPrefix("human:", MustCompileSchema([]byte(humanSchema)))
+	result, err := ks.ImportCSV(strings.NewReader(in), CSVOptions{
+		KeyColumn:  "id",
+		KeyPrefix:  "human:",
+		InferTypes: true,
+		DryRun:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 {
+		t.Errorf("want %d, got %d", 1, result.Imported)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Key != "human:2" {
+		t.Errorf("want an error of human:2, got %v", result.Errors)
+	} else if _, ok := result.Errors[0].Err.(*ValidationError); !ok {
+		t.Errorf("want *ValidationError, got %T", result.Errors[0].Err)
+	}
+	if ks.Size() != 0 {
+		t.Errorf("want %d, got %d", 0, ks.Size())
+	}
+}
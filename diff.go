@@ -0,0 +1,250 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// DiffType is the type of a difference.
+type DiffType int
+
+const (
+	// DiffAdded means the key or the member exists only in the new store.
+	DiffAdded DiffType = iota
+
+	// DiffRemoved means the key or the member exists only in the old store.
+	DiffRemoved
+
+	// DiffChanged means the value is changed.
+	DiffChanged
+)
+
+func (t DiffType) String() string {
+	switch t {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	}
+	return "unknown"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t DiffType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// KeyDiff is a difference of a key between two stores.
+type KeyDiff struct {
+	Key  string   `json:"key"`
+	Type DiffType `json:"type"`
+
+	// Old and New are the values in the old and new stores. They are nil if the key is missing.
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+
+	// Changes is the differences inside the value, if Type is DiffChanged.
+	Changes []ValueDiff `json:"changes,omitempty"`
+}
+
+// ValueDiff is a difference inside a JSON value.
+type ValueDiff struct {
+	Type DiffType `json:"type"`
+
+	// Path is the JSON Pointer to the changed part. It is empty for the whole value.
+	Path string `json:"path"`
+
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// Diff returns the differences from a to b sorted by the keys.
+// The values are compared as JSON, so the numbers and the order of the members
+// in objects do not matter. The sensitive fields are compared and reported decrypted.
+func Diff(a, b *JSONStore) []KeyDiff {
+	da := a.snapshot(false).plainData()
+	db := b.snapshot(false).plainData()
+
+	var diffs []KeyDiff
+	for _, key := range unionKeys(da, db) {
+		va, inA := da[key]
+		vb, inB := db[key]
+		switch {
+		case !inA:
+			diffs = append(diffs, KeyDiff{Key: key, Type: DiffAdded, New: vb})
+		case !inB:
+			diffs = append(diffs, KeyDiff{Key: key, Type: DiffRemoved, Old: va})
+		case !rawEqual(va, vb):
+			d := KeyDiff{Key: key, Type: DiffChanged, Old: va, New: vb}
+			d.Changes = diffValue(va, vb)
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
+
+func unionKeys(data ...map[string]json.RawMessage) []string {
+	seen := map[string]struct{}{}
+	var keys []string
+	for _, d := range data {
+		for k := range d {
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rawEqual reports whether a and b are the same JSON value.
+// nil means a missing value, which equals only nil.
+func rawEqual(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if bytes.Equal(a, b) {
+		return true
+	}
+	va, err := decodeUseNumber(a)
+	if err != nil {
+		return false
+	}
+	vb, err := decodeUseNumber(b)
+	if err != nil {
+		return false
+	}
+	return jsonEqual(va, vb)
+}
+
+func diffValue(a, b json.RawMessage) []ValueDiff {
+	va, err1 := decodeUseNumber(a)
+	vb, err2 := decodeUseNumber(b)
+	if err1 != nil || err2 != nil {
+		return []ValueDiff{{Type: DiffChanged, Old: a, New: b}}
+	}
+	var diffs []ValueDiff
+	diffJSON("", va, vb, &diffs)
+	return diffs
+}
+
+func diffJSON(ptr string, a, b interface{}, diffs *[]ValueDiff) {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		names := make([]string, 0, len(a)+len(b))
+		for name := range a {
+			names = append(names, name)
+		}
+		for name := range b {
+			if _, ok := a[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := ptr + "/" + escapePointer(name)
+			va, inA := a[name]
+			vb, inB := b[name]
+			switch {
+			case !inA:
+				*diffs = append(*diffs, ValueDiff{Type: DiffAdded, Path: p, New: marshalValue(vb)})
+			case !inB:
+				*diffs = append(*diffs, ValueDiff{Type: DiffRemoved, Path: p, Old: marshalValue(va)})
+			default:
+				diffJSON(p, va, vb, diffs)
+			}
+		}
+		return
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(a) || i < len(b); i++ {
+			p := ptr + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(a):
+				*diffs = append(*diffs, ValueDiff{Type: DiffAdded, Path: p, New: marshalValue(b[i])})
+			case i >= len(b):
+				*diffs = append(*diffs, ValueDiff{Type: DiffRemoved, Path: p, Old: marshalValue(a[i])})
+			default:
+				diffJSON(p, a[i], b[i], diffs)
+			}
+		}
+		return
+	}
+	if !jsonEqual(a, b) {
+		*diffs = append(*diffs, ValueDiff{Type: DiffChanged, Path: ptr, Old: marshalValue(a), New: marshalValue(b)})
+	}
+}
+
+func marshalValue(v interface{}) json.RawMessage {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+// DiffFormat is the output format of WriteDiff.
+type DiffFormat int
+
+const (
+	// DiffText is a human readable format.
+	// The lines start with "+" for added, "-" for removed, and "~" for changed.
+	// The changes inside a value are indented under the key.
+	DiffText DiffFormat = iota
+
+	// DiffJSON is a JSON array of KeyDiff.
+	DiffJSON
+)
+
+// WriteDiff writes diffs to w in format.
+func WriteDiff(w io.Writer, diffs []KeyDiff, format DiffFormat) error {
+	switch format {
+	case DiffJSON:
+		if diffs == nil {
+			diffs = []KeyDiff{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diffs)
+	case DiffText:
+		var buf bytes.Buffer
+		for _, d := range diffs {
+			switch d.Type {
+			case DiffAdded:
+				fmt.Fprintf(&buf, "+ %s: %s\n", d.Key, d.New)
+			case DiffRemoved:
+				fmt.Fprintf(&buf, "- %s: %s\n", d.Key, d.Old)
+			case DiffChanged:
+				fmt.Fprintf(&buf, "~ %s\n", d.Key)
+				for _, c := range d.Changes {
+					p := c.Path
+					if p == "" {
+						p = "/"
+					}
+					switch c.Type {
+					case DiffAdded:
+						fmt.Fprintf(&buf, "    + %s: %s\n", p, c.New)
+					case DiffRemoved:
+						fmt.Fprintf(&buf, "    - %s: %s\n", p, c.Old)
+					case DiffChanged:
+						fmt.Fprintf(&buf, "    ~ %s: %s -> %s\n", p, c.Old, c.New)
+					}
+				}
+			}
+		}
+		_, err := buf.WriteTo(w)
+		return err
+	}
+	return fmt.Errorf("jsonstore: unknown diff format %d", format)
+}
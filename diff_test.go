@@ -0,0 +1,93 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func newStoreFromJSON(t *testing.T, s string) *JSONStore {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &data); err != nil {
+		t.Fatal(err)
+	}
+	return newJSONStore(data, &defaultConfig)
+}
+
+func TestDiff(t *testing.T) {
+	a := newStoreFromJSON(t, `{
+		"same": {"a": 1, "b": [1, 2]},
+		"number": 1.0,
+		"removed": "bye",
+		"changed": {"Name": "Dante", "Height": 5.4, "Tags": ["a", "b"], "Old": true}
+	}`)
+	b := newStoreFromJSON(t, `{
+		"same": {"b": [1, 2], "a": 1},
+		"number": 1,
+		"added": "hello",
+		"changed": {"Name": "Dante", "Height": 5.5, "Tags": ["a"], "New": null}
+	}`)
+
+	want := []KeyDiff{
+		{Key: "added", Type: DiffAdded, New: json.RawMessage(`"hello"`)},
+		{
+			Key: "changed", Type: DiffChanged,
+			Old: json.RawMessage(`{"Name": "Dante", "Height": 5.4, "Tags": ["a", "b"], "Old": true}`),
+			New: json.RawMessage(`{"Name": "Dante", "Height": 5.5, "Tags": ["a"], "New": null}`),
+			Changes: []ValueDiff{
+				{Type: DiffChanged, Path: "/Height", Old: json.RawMessage(`5.4`), New: json.RawMessage(`5.5`)},
+				{Type: DiffAdded, Path: "/New", New: json.RawMessage(`null`)},
+				{Type: DiffRemoved, Path: "/Old", Old: json.RawMessage(`true`)},
+				{Type: DiffRemoved, Path: "/Tags/1", Old: json.RawMessage(`"b"`)},
+			},
+		},
+		{Key: "removed", Type: DiffRemoved, Old: json.RawMessage(`"bye"`)},
+	}
+	got := Diff(a, b)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	if diffs := Diff(a, a); len(diffs) != 0 {
+		t.Errorf("want no differences, got %v", diffs)
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	a := newStoreFromJSON(t, `{"removed": 1, "changed": {"a": 1, "b": 2}, "type": 1}`)
+	b := newStoreFromJSON(t, `{"added": 2, "changed": {"a": 2, "c": 3}, "type": "1"}`)
+	diffs := Diff(a, b)
+
+	var buf bytes.Buffer
+	if err := WriteDiff(&buf, diffs, DiffText); err != nil {
+		t.Fatal(err)
+	}
+	want := `+ added: 2
+~ changed
+    ~ /a: 1 -> 2
+    - /b: 2
+    + /c: 3
+- removed: 1
+~ type
+    ~ /: 1 -> "1"
+`
+	if buf.String() != want {
+		t.Errorf("want %q, got %q", want, buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteDiff(&buf, diffs, DiffJSON); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []struct {
+		Key  string
+		Type string
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 4 || decoded[0].Key != "added" || decoded[0].Type != "added" {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
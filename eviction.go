@@ -0,0 +1,181 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// EvictionPolicy selects the keys which are evicted when the store exceeds its limits.
+type EvictionPolicy int
+
+const (
+	// EvictLRU evicts the least recently used key.
+	EvictLRU EvictionPolicy = iota
+
+	// EvictLFU evicts the least frequently used key.
+	EvictLFU
+
+	// EvictRandom evicts a random key.
+	EvictRandom
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictLRU:
+		return "lru"
+	case EvictLFU:
+		return "lfu"
+	case EvictRandom:
+		return "random"
+	}
+	return "unknown"
+}
+
+// evictionSamples is the number of keys sampled for choosing a victim.
+// Like Redis, LRU and LFU are approximated by evicting the best candidate of some random keys,
+// which avoids keeping an ordered list that every read would have to update.
+const evictionSamples = 5
+
+// Limits bounds the size of a JSONStore.
+// When a write makes the store exceed the limits, other keys are evicted.
+// Evicted keys are treated as deletions: watchers receive EventEvict, and
+// they are not saved to the file.
+type Limits struct {
+	// MaxEntries is the maximum number of keys. Zero means no limit.
+	MaxEntries int
+
+	// MaxBytes is the maximum total length of the raw JSON values. Zero means no limit.
+	MaxBytes int64
+
+	// Policy selects the keys to evict.
+	Policy EvictionPolicy
+
+	// OnEvict is called after a key is evicted, if it is not nil.
+	// value is shared with the store, so OnEvict MUST NOT modify it.
+	OnEvict func(key string, value json.RawMessage)
+}
+
+func (l *Limits) enabled() bool {
+	return l.MaxEntries > 0 || l.MaxBytes > 0
+}
+
+// EvictionStats is the statistics of eviction.
+type EvictionStats struct {
+	// Evictions is the number of evicted keys.
+	Evictions int64
+
+	// EvictedBytes is the total length of the evicted values.
+	EvictedBytes int64
+
+	// Entries and Bytes are the current number of keys and total length of the values.
+	Entries int
+	Bytes   int64
+}
+
+// SetLimits sets the limits of the store.
+// The store is shrunk immediately if it exceeds the new limits.
+func (s *JSONStore) SetLimits(l Limits) {
+	s.updateConfig(func(c *config) {
+		c.limits = l
+	})
+	s.evict(s.getConfig(), "")
+}
+
+// EvictionStats returns the statistics of eviction.
+func (s *JSONStore) EvictionStats() EvictionStats {
+	stats := EvictionStats{
+		Evictions:    atomic.LoadInt64(&s.evictions),
+		EvictedBytes: atomic.LoadInt64(&s.evictedBytes),
+	}
+	for _, t := range s.loadTrees() {
+		stats.Entries += t.Len()
+		stats.Bytes += t.Bytes()
+	}
+	return stats
+}
+
+// epoch is the origin of entry.atime.
+var epoch = time.Now()
+
+// touch records an access to e.
+func (e *entry) touch() {
+	atomic.StoreInt64(&e.atime, int64(time.Since(epoch)))
+	atomic.AddInt64(&e.hits, 1)
+}
+
+// usage returns the number of keys and the total length of the values.
+// It is not a consistent view of the store, but it is enough for checking the limits.
+func (s *JSONStore) usage() (int, int64) {
+	entries, bytes := 0, int64(0)
+	for i := range s.shards {
+		t := s.shards[i].load()
+		entries += t.Len()
+		bytes += t.Bytes()
+	}
+	return entries, bytes
+}
+
+// evict evicts keys until the store is within the limits.
+// The key which has just been written is kept.
+func (s *JSONStore) evict(c *config, keep string) {
+	l := &c.limits
+	if !l.enabled() {
+		return
+	}
+	for {
+		entries, bytes := s.usage()
+		if (l.MaxEntries <= 0 || entries <= l.MaxEntries) && (l.MaxBytes <= 0 || bytes <= l.MaxBytes) {
+			return
+		}
+		if entries == 0 || (entries == 1 && keep != "") {
+			return
+		}
+		victim, ok := s.chooseVictim(l.Policy, keep)
+		if !ok {
+			continue
+		}
+		old, _ := s.remove(victim, EventEvict, AnyVersion)
+		if old == nil {
+			// another goroutine has removed it.
+			continue
+		}
+		atomic.AddInt64(&s.evictions, 1)
+		atomic.AddInt64(&s.evictedBytes, int64(len(old.value)))
+		if l.OnEvict != nil {
+			l.OnEvict(victim, old.value)
+		}
+	}
+}
+
+// chooseVictim samples some keys and returns the best one to evict.
+func (s *JSONStore) chooseVictim(policy EvictionPolicy, keep string) (string, bool) {
+	var victim string
+	var best int64
+	found := false
+	samples := evictionSamples
+	if policy == EvictRandom {
+		samples = 1
+	}
+	// give up after some attempts; the caller will retry.
+	for attempts := 4 * evictionSamples; attempts > 0 && samples > 0; attempts-- {
+		sh := &s.shards[rand.Intn(shardCount)]
+		key, e, ok := sh.load().Random()
+		if !ok || key == keep {
+			continue
+		}
+		samples--
+		var score int64
+		switch policy {
+		case EvictLRU:
+			score = atomic.LoadInt64(&e.atime)
+		case EvictLFU:
+			score = atomic.LoadInt64(&e.hits)
+		}
+		if !found || score < best {
+			victim, best, found = key, score, true
+		}
+	}
+	return victim, found
+}
@@ -0,0 +1,147 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestLimitsMaxEntries(t *testing.T) {
+	for _, policy := range []EvictionPolicy{EvictLRU, EvictLFU, EvictRandom} {
+		t.Run(policy.String(), func(t *testing.T) {
+			ks := new(JSONStore)
+			var mu sync.Mutex
+			evicted := map[string]bool{}
+			ks.SetLimits(Limits{
+				MaxEntries: 10,
+				Policy:     policy,
+				OnEvict: func(key string, value json.RawMessage) {
+					mu.Lock()
+					evicted[key] = true
+					mu.Unlock()
+				},
+			})
+			for i := 0; i < 100; i++ {
+				if err := ks.Set(key(i), i); err != nil {
+					t.Fatal(err)
+				}
+				if ks.Size() > 10 {
+					t.Fatalf("the store exceeds the limit: %d", ks.Size())
+				}
+				// the key which has just been written is kept.
+				if _, err := ks.GetRaw(key(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stats := ks.EvictionStats()
+			if stats.Evictions != 90 || len(evicted) != 90 || stats.Entries != 10 {
+				t.Errorf("unexpected stats: %+v, %d evicted", stats, len(evicted))
+			}
+			for _, k := range ks.Keys() {
+				if evicted[k] {
+					t.Errorf("%s is evicted, but it is in the store", k)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitsMaxBytes(t *testing.T) {
+	ks := new(JSONStore)
+	ks.SetLimits(Limits{MaxBytes: 100})
+	for i := 0; i < 100; i++ {
+		ks.Set(key(i), "0123456789") // 12 bytes
+	}
+	stats := ks.EvictionStats()
+	if stats.Bytes > 100 || stats.Entries != 8 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.EvictedBytes != 92*12 {
+		t.Errorf("want %d, got %d", 92*12, stats.EvictedBytes)
+	}
+
+	// a value larger than the limit evicts all the others, but it is kept.
+	ks.Set("large", string(make([]byte, 200)))
+	if ks.Size() != 1 {
+		t.Errorf("want 1, got %d", ks.Size())
+	}
+}
+
+func TestLimitsLRU(t *testing.T) {
+	ks := new(JSONStore)
+	for i := 0; i < 100; i++ {
+		ks.Set(key(i), i)
+	}
+	ks.SetLimits(Limits{MaxEntries: 100, Policy: EvictLRU})
+
+	// key-0 is the most recently used.
+	var v int
+	for i := 0; i < 100; i++ {
+		ks.Set(key(100+i), 100+i)
+		if err := ks.Get(key(0), &v); err != nil {
+			t.Fatalf("recently used key is evicted at %d", i)
+		}
+	}
+}
+
+func TestLimitsLFU(t *testing.T) {
+	ks := new(JSONStore)
+	ks.SetLimits(Limits{MaxEntries: 50, Policy: EvictLFU})
+	ks.Set("hot", 0)
+	var v int
+	for i := 0; i < 100; i++ {
+		ks.Get("hot", &v)
+	}
+	for i := 0; i < 200; i++ {
+		ks.Set(key(i), i)
+	}
+	if err := ks.Get("hot", &v); err != nil {
+		t.Error("frequently used key is evicted")
+	}
+}
+
+func TestLimitsShrink(t *testing.T) {
+	ks := new(JSONStore)
+	for i := 0; i < 100; i++ {
+		ks.Set(key(i), i)
+	}
+	var events int
+	ks.OnChange(func(ev Event) {
+		if ev.Type == EventEvict {
+			events++
+		}
+	})
+	ks.SetLimits(Limits{MaxEntries: 10})
+	if ks.Size() != 10 {
+		t.Errorf("want 10, got %d", ks.Size())
+	}
+	if events != 90 {
+		t.Errorf("want 90 events, got %d", events)
+	}
+}
+
+func TestLimitsSave(t *testing.T) {
+	name, cleanup, err := setupJsonstore(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ks, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.StartAutoSave(name, 0, 1)
+	ks.SetLimits(Limits{MaxEntries: 10})
+	ks.StopAutoSave()
+
+	// evicted keys are deleted from the file.
+	ks2, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks2.Size() != 10 {
+		t.Errorf("want 10, got %d", ks2.Size())
+	}
+}
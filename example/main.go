@@ -33,7 +33,7 @@ func main() {
 	wg.Wait()
 
 	// Load any JSON / GZipped JSON
-	ks2, err := jsonstore.Open("test.json.gz")
+	ks2, err := jsonstore.OpenFile("test.json.gz", jsonstore.Options{})
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,368 @@
+package jsonstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// RedactedValue replaces the sensitive fields in ExportRedacted.
+var RedactedValue = json.RawMessage(`"[REDACTED]"`)
+
+// SensitiveFields is the fields of values which hold secrets.
+type SensitiveFields struct {
+	// Prefix limits the fields to the keys which have the prefix. Empty means all keys.
+	Prefix string
+
+	// Paths are JSON Pointers of the fields, such as "/password".
+	// The reference token "*" matches all members of an object or all elements of an array.
+	Paths []string
+
+	// Key encrypts the fields transparently: Set and other writing methods encrypt them,
+	// and Get and other reading methods decrypt them.
+	// Range, events and the saved files have the encrypted fields.
+	// If Key is nil, the fields are not encrypted, but they are redacted by ExportRedacted.
+	Key *Key
+
+	// OldKeys decrypt the fields encrypted before key rotation.
+	// The fields are encrypted with Key when the values are set again.
+	OldKeys []*Key
+}
+
+type sensitiveEntry struct {
+	prefix string
+	paths  []fieldPath
+	key    *Key
+	keys   []*Key // the keys for decryption
+}
+
+type fieldPath struct {
+	tokens []string
+}
+
+// RegisterSensitiveFields registers the sensitive fields.
+// The values already in the store are not encrypted until they are set again.
+func (s *JSONStore) RegisterSensitiveFields(f SensitiveFields) error {
+	e := sensitiveEntry{prefix: f.Prefix, key: f.Key}
+	for _, p := range f.Paths {
+		if p != "" && p[0] != '/' {
+			return errors.New("jsonstore: invalid JSON Pointer: " + strconv.Quote(p))
+		}
+		var tokens []string
+		if p != "" {
+			tokens = strings.Split(p[1:], "/")
+			for i, t := range tokens {
+				tokens[i] = unescapePointer(t)
+			}
+		}
+		e.paths = append(e.paths, fieldPath{tokens: tokens})
+	}
+	if f.Key != nil {
+		e.keys = append(e.keys, f.Key)
+	}
+	e.keys = append(e.keys, f.OldKeys...)
+
+	s.updateConfig(func(c *config) {
+		sensitive := make([]sensitiveEntry, 0, len(c.sensitive)+1)
+		sensitive = append(sensitive, c.sensitive...)
+		c.sensitive = append(sensitive, e)
+	})
+	return nil
+}
+
+// transformFields calls fn for the sensitive fields of the value at key with the JSON Pointers of the fields.
+// If fn changes no fields, value is returned as is.
+func (c *config) transformFields(key string, value json.RawMessage, fn func(e *sensitiveEntry, pointer string, v json.RawMessage) (json.RawMessage, error)) (json.RawMessage, error) {
+	for i := range c.sensitive {
+		e := &c.sensitive[i]
+		if !strings.HasPrefix(key, e.prefix) {
+			continue
+		}
+		for j := range e.paths {
+			p := &e.paths[j]
+			v, _, err := transformPath(value, "", p.tokens, func(pointer string, v json.RawMessage) (json.RawMessage, error) {
+				return fn(e, pointer, v)
+			})
+			if err != nil {
+				return nil, err
+			}
+			value = v
+		}
+	}
+	return value, nil
+}
+
+// encryptFields encrypts the sensitive fields of the value at key.
+// The fields are always encrypted, even if they look encrypted, because the prefix
+// of the encrypted fields may be a part of plaintext.
+func (c *config) encryptFields(key string, value json.RawMessage) (json.RawMessage, error) {
+	if len(c.sensitive) == 0 {
+		return value, nil
+	}
+	return c.transformFields(key, value, func(e *sensitiveEntry, pointer string, v json.RawMessage) (json.RawMessage, error) {
+		if e.key == nil {
+			return v, nil
+		}
+		return encryptField(e.key, fieldData(key, pointer), v)
+	})
+}
+
+// openFields decrypts the sensitive fields of the value at key which are encrypted with the keys,
+// such as the values restored from an export. The other fields are plaintext, even if they look encrypted.
+func (c *config) openFields(key string, value json.RawMessage) (json.RawMessage, error) {
+	if len(c.sensitive) == 0 {
+		return value, nil
+	}
+	return c.transformFields(key, value, func(e *sensitiveEntry, pointer string, v json.RawMessage) (json.RawMessage, error) {
+		if !isEncryptedField(v) {
+			return v, nil
+		}
+		if plain, err := decryptField(e.keys, fieldData(key, pointer), v); err == nil {
+			return plain, nil
+		}
+		return v, nil
+	})
+}
+
+// decryptFields decrypts the sensitive fields of the value at key.
+func (c *config) decryptFields(key string, value json.RawMessage) (json.RawMessage, error) {
+	if len(c.sensitive) == 0 {
+		return value, nil
+	}
+	return c.transformFields(key, value, func(e *sensitiveEntry, pointer string, v json.RawMessage) (json.RawMessage, error) {
+		if !isEncryptedField(v) {
+			return v, nil
+		}
+		return decryptField(e.keys, fieldData(key, pointer), v)
+	})
+}
+
+// plainData returns the data of the snapshot with the sensitive fields decrypted,
+// so the values can be compared and validated.
+// The fields which can not be decrypted are left encrypted.
+// The values don't refer to the mapped memory, so they can outlive the store.
+func (snapshot *snapshot) plainData() map[string]json.RawMessage {
+	c := snapshot.config
+	data := make(map[string]json.RawMessage, snapshot.len())
+	snapshot.each(func(key string, e *entry) bool {
+		v, err := c.decryptFields(key, e.value)
+		if err != nil {
+			v = e.value
+		}
+		data[key] = c.detach(v)
+		return true
+	})
+	return data
+}
+
+// redactFields replaces the sensitive fields of the value at key with RedactedValue.
+func (c *config) redactFields(key string, value json.RawMessage) (json.RawMessage, error) {
+	if len(c.sensitive) == 0 {
+		return value, nil
+	}
+	return c.transformFields(key, value, func(e *sensitiveEntry, pointer string, v json.RawMessage) (json.RawMessage, error) {
+		return RedactedValue, nil
+	})
+}
+
+// transformPath replaces the values at the path with the results of fn,
+// and reports whether some values are replaced. The missing path is ignored.
+// fn is called with the JSON Pointer of the value, which starts with pointer.
+func transformPath(value json.RawMessage, pointer string, tokens []string, fn func(pointer string, v json.RawMessage) (json.RawMessage, error)) (json.RawMessage, bool, error) {
+	if len(tokens) == 0 {
+		v, err := fn(pointer, value)
+		if err != nil {
+			return nil, false, err
+		}
+		return v, !bytes.Equal(v, value), nil
+	}
+	token, rest := tokens[0], tokens[1:]
+	trimmed := bytes.TrimSpace(value)
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(value, &members); err != nil {
+			return nil, false, err
+		}
+		changed := false
+		for name, v := range members {
+			if token != "*" && token != name {
+				continue
+			}
+			nv, ok, err := transformPath(v, pointer+"/"+escapePointer(name), rest, fn)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				members[name] = nv
+				changed = true
+			}
+		}
+		if !changed {
+			return value, false, nil
+		}
+		b, err := json.Marshal(members)
+		return b, err == nil, err
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		var elements []json.RawMessage
+		if err := json.Unmarshal(value, &elements); err != nil {
+			return nil, false, err
+		}
+		changed := false
+		for i, v := range elements {
+			if token != "*" && token != strconv.Itoa(i) {
+				continue
+			}
+			nv, ok, err := transformPath(v, pointer+"/"+strconv.Itoa(i), rest, fn)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				elements[i] = nv
+				changed = true
+			}
+		}
+		if !changed {
+			return value, false, nil
+		}
+		b, err := json.Marshal(elements)
+		return b, err == nil, err
+	}
+	return value, false, nil
+}
+
+// The encrypted fields are JSON strings of fieldPrefix and base64 of:
+//
+//	kdf, logN, r, p uint8
+//	kdfSalt         [16]byte
+//	nonce           [12]byte
+//	ciphertext
+//
+// The plaintext is the JSON of the field, and the additional data is the JSON array of
+// the store key and the JSON Pointer of the field, such as ["user:1","/password"],
+// so a field can't be moved to another key or another path.
+const fieldPrefix = "$jsenc1$"
+
+const fieldHeaderSize = 4 + encSaltSize
+
+func isEncryptedField(v json.RawMessage) bool {
+	return bytes.HasPrefix(v, []byte(`"`+fieldPrefix))
+}
+
+func fieldAEAD(master []byte) (cipher.AEAD, error) {
+	r := hkdf.New(sha256.New, master, nil, []byte("jsonstore field encryption"))
+	var key [KeySize]byte
+	if _, err := io.ReadFull(r, key[:]); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// fieldData returns the additional data of the field at pointer in the value at key.
+func fieldData(key, pointer string) []byte {
+	b, _ := json.Marshal([]string{key, pointer})
+	return b
+}
+
+func encryptField(key *Key, data []byte, v json.RawMessage) (json.RawMessage, error) {
+	params, err := key.encryptionParams()
+	if err != nil {
+		return nil, err
+	}
+	master, err := key.master(params)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := fieldAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 0, fieldHeaderSize+aead.NonceSize()+len(v)+aead.Overhead())
+	kdf := byte(kdfNone)
+	if key.raw == nil {
+		kdf = kdfScrypt
+	}
+	b = append(b, kdf, params.logN, params.r, params.p)
+	b = append(b, params.salt[:]...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	b = append(b, nonce...)
+	b = aead.Seal(b, nonce, v, data)
+	return json.Marshal(fieldPrefix + base64.RawURLEncoding.EncodeToString(b))
+}
+
+func decryptField(keys []*Key, data []byte, v json.RawMessage) (json.RawMessage, error) {
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil {
+		return nil, ErrCorrupt
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, fieldPrefix))
+	if err != nil || len(b) < fieldHeaderSize {
+		return nil, ErrCorrupt
+	}
+	kdf := b[0]
+	params := scryptParams{logN: b[1], r: b[2], p: b[3]}
+	copy(params.salt[:], b[4:fieldHeaderSize])
+	b = b[fieldHeaderSize:]
+	if kdf == kdfScrypt && !params.valid() {
+		return nil, ErrCorrupt
+	}
+
+	for _, key := range keys {
+		if (key.raw == nil) != (kdf == kdfScrypt) {
+			continue
+		}
+		master, err := key.master(params)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := fieldAEAD(master)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) < aead.NonceSize()+aead.Overhead() {
+			return nil, ErrCorrupt
+		}
+		plain, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], data)
+		if err == nil {
+			return plain, nil
+		}
+	}
+	// GCM can't tell a wrong key from broken data.
+	return nil, ErrWrongKey
+}
+
+// ExportRedacted writes the store in the same format as Save,
+// with the sensitive fields replaced by RedactedValue.
+// The sensitive fields are redacted whether they are encrypted or not.
+func (s *JSONStore) ExportRedacted(w io.Writer) error {
+	c := s.getConfig()
+	snapshot := s.snapshot(false)
+	data := make(map[string]json.RawMessage, snapshot.len())
+	var err error
+	snapshot.each(func(key string, e *entry) bool {
+		data[key], err = c.redactFields(key, e.value)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return snapshot.config.getCodec().NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,207 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type account struct {
+	Name     string   `json:"name"`
+	Password string   `json:"password"`
+	Tokens   []string `json:"tokens"`
+}
+
+func TestSensitiveFields(t *testing.T) {
+	ks := new(JSONStore)
+	err := ks.RegisterSensitiveFields(SensitiveFields{
+		Prefix: "account:",
+		Paths:  []string{"/password", "/tokens/*"},
+		Key:    newTestKey(t, 1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := account{Name: "dante", Password: "hunter2", Tokens: []string{"t0k3n", "s3cr3t"}}
+	if err := ks.Set("account:1", want); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Set("other", want); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored []byte
+	ks.Range(func(key string, value json.RawMessage) bool {
+		if key == "account:1" {
+			stored = value
+		}
+		return true
+	})
+	if bytes.Contains(stored, []byte("hunter2")) || bytes.Contains(stored, []byte("t0k3n")) {
+		t.Errorf("the fields are not encrypted: %s", stored)
+	}
+	if !bytes.Contains(stored, []byte(`"name":"dante"`)) {
+		t.Errorf("the other fields are encrypted: %s", stored)
+	}
+
+	var got account
+	if err := ks.Get("account:1", &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Password != want.Password || strings.Join(got.Tokens, ",") != "t0k3n,s3cr3t" {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// the encrypted fields are kept by a merge patch.
+	if _, _, err := ks.MergePatch("account:1", json.RawMessage(`{"name":"virgil"}`), AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	raw, _, err := ks.GetRawVersion("account:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"virgil","password":"hunter2","tokens":["t0k3n","s3cr3t"]}`; string(raw) != want {
+		t.Errorf("want %s, got %s", want, raw)
+	}
+
+	// the keys without the prefix are not encrypted.
+	if raw, _ := ks.GetRawUnsafe("other"); !bytes.Contains(raw, []byte("hunter2")) {
+		t.Errorf("want plain, got %s", raw)
+	}
+
+	var buf bytes.Buffer
+	if err := ks.ExportRedacted(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "$jsenc") {
+		t.Errorf("the encrypted fields are exported: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"password":"[REDACTED]","tokens":["[REDACTED]","[REDACTED]"]`) {
+		t.Errorf("the fields are not redacted: %s", buf.String())
+	}
+}
+
+func TestSensitiveFields_Rotation(t *testing.T) {
+	oldKey, newKey := newTestKey(t, 1), newTestKey(t, 2)
+	ks := new(JSONStore)
+	ks.RegisterSensitiveFields(SensitiveFields{Paths: []string{"/password"}, Key: oldKey})
+	ks.Set("account:1", account{Name: "dante", Password: "hunter2"})
+
+	// reopen the data with other keys.
+	withKeys := func(key *Key, oldKeys ...*Key) *JSONStore {
+		ks2 := newJSONStore(ks.snapshot(false).data(), &defaultConfig)
+		ks2.RegisterSensitiveFields(SensitiveFields{Paths: []string{"/password"}, Key: key, OldKeys: oldKeys})
+		return ks2
+	}
+
+	var v account
+	if err := withKeys(newKey).Get("account:1", &v); err != ErrWrongKey {
+		t.Errorf("want %v, got %v", ErrWrongKey, err)
+	}
+
+	ks2 := withKeys(newKey, oldKey)
+	if err := ks2.Get("account:1", &v); err != nil || v.Password != "hunter2" {
+		t.Errorf("want %q, got %q, %v", "hunter2", v.Password, err)
+	}
+	if err := ks2.Set("account:1", v); err != nil {
+		t.Fatal(err)
+	}
+	ks = ks2
+	if err := withKeys(newKey).Get("account:1", &v); err != nil || v.Password != "hunter2" {
+		t.Errorf("want %q, got %q, %v", "hunter2", v.Password, err)
+	}
+
+	if err := ks.RegisterSensitiveFields(SensitiveFields{Paths: []string{"password"}}); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestSensitiveFields_Binding(t *testing.T) {
+	key := newTestKey(t, 1)
+	fields := SensitiveFields{Paths: []string{"/password", "/tokens/*"}, Key: key}
+	ks := new(JSONStore)
+	ks.RegisterSensitiveFields(fields)
+	ks.Set("account:alice", account{Name: "alice", Password: "hunter2", Tokens: []string{"t0k3n", "s3cr3t"}})
+	ks.Set("account:mallory", account{Name: "mallory", Password: "mallory"})
+	data := ks.snapshot(false).data()
+
+	// the fields copied to another key are not decrypted.
+	var alice account
+	json.Unmarshal(data["account:alice"], &alice)
+	copied := map[string]json.RawMessage{"account:mallory": data["account:alice"]}
+	ks2 := newJSONStore(copied, &defaultConfig)
+	ks2.RegisterSensitiveFields(fields)
+	var v account
+	if err := ks2.Get("account:mallory", &v); err != ErrWrongKey {
+		t.Errorf("want %v, got %v, %v", ErrWrongKey, err, v)
+	}
+
+	// the fields moved to another path are not decrypted.
+	alice.Tokens[0], alice.Tokens[1] = alice.Tokens[1], alice.Tokens[0]
+	swapped, _ := json.Marshal(alice)
+	ks3 := newJSONStore(map[string]json.RawMessage{"account:alice": swapped}, &defaultConfig)
+	ks3.RegisterSensitiveFields(fields)
+	if err := ks3.Get("account:alice", &v); err != ErrWrongKey {
+		t.Errorf("want %v, got %v, %v", ErrWrongKey, err, v)
+	}
+}
+
+func TestSensitiveFields_Prefix(t *testing.T) {
+	ks := new(JSONStore)
+	ks.RegisterSensitiveFields(SensitiveFields{Paths: []string{"/password"}, Key: newTestKey(t, 1)})
+
+	// plaintext which looks encrypted is encrypted too.
+	want := account{Name: "dante", Password: fieldPrefix + "hunter2"}
+	if err := ks.Set("account:1", want); err != nil {
+		t.Fatal(err)
+	}
+	var stored json.RawMessage
+	ks.Range(func(key string, value json.RawMessage) bool {
+		stored = value
+		return true
+	})
+	if bytes.Contains(stored, []byte("hunter2")) {
+		t.Errorf("the field is not encrypted: %s", stored)
+	}
+	var got account
+	if err := ks.Get("account:1", &got); err != nil || got.Password != want.Password {
+		t.Errorf("want %q, got %q, %v", want.Password, got.Password, err)
+	}
+
+	// the encrypted fields restored from an export are not encrypted twice.
+	ks.Delete("account:1")
+	if err := ks.SetRaw("account:1", stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Get("account:1", &got); err != nil || got.Password != want.Password {
+		t.Errorf("want %q, got %q, %v", want.Password, got.Password, err)
+	}
+}
+
+func TestSensitiveFields_ValidateAndDiff(t *testing.T) {
+	newStore := func() *JSONStore {
+		ks := new(JSONStore)
+		ks.RegisterSensitiveFields(SensitiveFields{Paths: []string{"/pin"}, Key: newTestKey(t, 1)})
+		ks.RegisterSchema("*", MustCompileSchema([]byte(`{"properties":{"pin":{"type":"integer"}}}`)))
+		if err := ks.Set("card", map[string]int{"pin": 1234}); err != nil {
+			t.Fatal(err)
+		}
+		return ks
+	}
+	a, b := newStore(), newStore()
+
+	if err := a.Validate(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+	if diffs := Diff(a, b); len(diffs) != 0 {
+		t.Errorf("want no differences, got %v", diffs)
+	}
+
+	b.Set("card", map[string]int{"pin": 4321})
+	diffs := Diff(a, b)
+	if len(diffs) != 1 || len(diffs[0].Changes) != 1 || diffs[0].Changes[0].Path != "/pin" {
+		t.Errorf("unexpected differences: %v", diffs)
+	}
+}
@@ -0,0 +1,194 @@
+package jsonstore
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Format is the format of store files.
+type Format int
+
+const (
+	// FormatAuto decides the format by the file name: gzipped JSON if it has the ".gz" suffix, otherwise JSON.
+	FormatAuto Format = iota
+
+	// FormatJSON is JSON.
+	FormatJSON
+
+	// FormatGzip is gzipped JSON.
+	FormatGzip
+)
+
+// DefaultFileMode is the permission of the files written by the store, before umask.
+const DefaultFileMode os.FileMode = 0666
+
+// Options is the options of OpenFile.
+type Options struct {
+	// Create makes an empty store file if the file doesn't exist.
+	// The file is not created for the read-only stores or with LockShared, but the store is empty.
+	Create bool
+
+	// Mode is the permission of the files written by the store. Zero means DefaultFileMode.
+	Mode os.FileMode
+
+	// Format is the format of the file.
+	Format Format
+
+	// Codec decodes and encodes the file and the values. If it is nil, DefaultCodec is used.
+	Codec Codec
+
+	// Keys decrypt the file, and the first key encrypts the saved files.
+	// The keys are tried in order. To rotate keys, open the file with the new key followed by the old keys, and save it.
+	// If Keys is empty, the file is not encrypted.
+	Keys []*Key
+
+	// Lock locks the file while the store is open. Call Close to release it.
+	Lock *LockOptions
+
+	// ReadOnly opens the store in the read-only mode.
+	// The writing methods which return errors return ErrReadOnly, and Delete and StartAutoSave,
+	// which can't return errors, do nothing. AutoSaveInterval and AutoSaveCount must be zero.
+	// The read-only handles of the same file share the memory while the file is not changed,
+	// except for encrypted files. Call Close when the store is no longer needed.
+	ReadOnly bool
+
+	// Mmap maps the file into memory instead of reading it, and the values refer to the mapped memory.
+	// It requires ReadOnly.
+	// The file must be replaced, not be rewritten in place, while it is mapped. The saves of this package replace it.
+	// The values returned by GetRawUnsafe MUST NOT be used after Close.
+	// Mmap is ignored for gzipped or encrypted files, and on the platforms which don't support it.
+	Mmap bool
+
+	// AutoSaveInterval and AutoSaveCount start auto saving to the file.
+	// See StartAutoSave. The auto saving is disabled if both are zero.
+	AutoSaveInterval time.Duration
+	AutoSaveCount    int64
+
+	// Sync makes the saved files durable: the files are synced to the disk before they are closed,
+	// and the directory is synced after the file is renamed.
+	Sync bool
+}
+
+// LockOptions is the options of the file lock of OpenFile.
+type LockOptions struct {
+	Mode    LockMode
+	Timeout time.Duration
+}
+
+// OpenFile opens a store file with opts.
+// Save writes the store to the file with the options.
+func OpenFile(name string, opts Options) (*JSONStore, error) {
+	if opts.ReadOnly && (opts.AutoSaveInterval != 0 || opts.AutoSaveCount != 0) {
+		return nil, errors.New("jsonstore: auto saving a read-only store")
+	}
+	if opts.Mmap && !opts.ReadOnly {
+		return nil, errors.New("jsonstore: mmap requires the read-only mode")
+	}
+	cfg := &config{
+		codec:    opts.Codec,
+		format:   opts.Format,
+		mode:     opts.Mode,
+		sync:     opts.Sync,
+		filename: name,
+		keys:     opts.Keys,
+	}
+	if len(opts.Keys) > 0 {
+		cfg.key = opts.Keys[0]
+	}
+
+	var lock *FileLock
+	if opts.Lock != nil {
+		var err error
+		lock, err = Lock(name, opts.Lock.Mode, opts.Lock.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		// the lock is checked by the first write.
+		cfg.lock = lock
+	}
+
+	var ks *JSONStore
+	var err error
+	if opts.ReadOnly {
+		ks, err = openReadOnly(name, cfg, opts.Keys, opts.Mmap)
+	} else {
+		ks, err = openFile(name, cfg, opts.Keys)
+	}
+	if os.IsNotExist(err) && opts.Create {
+		ks, err = newJSONStore(nil, cfg), nil
+		if opts.ReadOnly {
+			ks.updateConfig(func(c *config) {
+				c.readOnly = true
+			})
+		} else if lock == nil || lock.Mode() == LockExclusive {
+			err = saveAndRename(ks.snapshot(false), name)
+		}
+	}
+	if err != nil {
+		if lock != nil {
+			lock.Unlock()
+		}
+		return nil, err
+	}
+
+	ks.updateConfig(func(c *config) {
+		c.lock = lock
+		c.filename = name
+	})
+	if opts.AutoSaveInterval != 0 || opts.AutoSaveCount != 0 {
+		ks.StartAutoSave(name, opts.AutoSaveInterval, opts.AutoSaveCount)
+	}
+	return ks, nil
+}
+
+// Save writes the store to the file opened by OpenFile in the same way as SaveAndRename.
+func (s *JSONStore) Save() error {
+	snapshot := s.snapshot(false)
+	if snapshot.config.filename == "" {
+		return errors.New("jsonstore: the store is not opened by OpenFile")
+	}
+	if snapshot.config.readOnly {
+		return ErrReadOnly
+	}
+	if err := s.saveTo(snapshot, snapshot.config.filename); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&s.savedCount, snapshot.setCount)
+	return nil
+}
+
+// gzip reports whether the file is gzipped.
+func (c *config) gzip(filename string) bool {
+	switch c.format {
+	case FormatJSON:
+		return false
+	case FormatGzip:
+		return true
+	}
+	return strings.HasSuffix(filename, ".gz")
+}
+
+func (c *config) fileMode() os.FileMode {
+	if c.mode == 0 {
+		return DefaultFileMode
+	}
+	return c.mode
+}
+
+// syncDir syncs the directory, so a renamed file survives a crash.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		// directories can't be synced on Windows.
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,123 @@
+package jsonstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "foo.json")
+
+	if _, err := OpenFile(filename, Options{}); !os.IsNotExist(err) {
+		t.Errorf("want not exist, got %v", err)
+	}
+
+	ks, err := OpenFile(filename, Options{Create: true, Mode: 0600, Format: FormatGzip, Sync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("want %v, got %v", os.FileMode(0600), info.Mode().Perm())
+	}
+
+	ks.Set("hello", "world")
+	if err := ks.Save(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		t.Errorf("want gzip, got %q", b)
+	}
+	if info, _ := os.Stat(filename); info.Mode().Perm() != 0600 {
+		t.Errorf("want %v, got %v", os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// the format is not decided by the file name.
+	if _, err := OpenFile(filename, Options{}); err == nil {
+		t.Error("want error, got nil")
+	}
+	ks2, err := OpenFile(filename, Options{Format: FormatGzip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v string
+	if err := ks2.Get("hello", &v); err != nil || v != "world" {
+		t.Errorf("want %q, got %q, %v", "world", v, err)
+	}
+
+	if err := new(JSONStore).Save(); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestOpenFile_AutoSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "foo.json")
+
+	ks, err := OpenFile(filename, Options{Create: true, AutoSaveCount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("hello", "world")
+	ks.StopAutoSave()
+
+	ks2, err := OpenFile(filename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks2.Size() != 1 {
+		t.Errorf("want %d, got %d", 1, ks2.Size())
+	}
+}
+
+func TestOpenFile_ReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "foo.json")
+
+	ks, err := OpenFile(filename, Options{Create: true, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("want not exist, got %v", err)
+	}
+	if err := ks.Set("hello", "world"); err != ErrReadOnly {
+		t.Errorf("want %v, got %v", ErrReadOnly, err)
+	}
+	if err := ks.Save(); err != ErrReadOnly {
+		t.Errorf("want %v, got %v", ErrReadOnly, err)
+	}
+	if _, err := OpenFile(filename, Options{Create: true, ReadOnly: true, AutoSaveInterval: time.Second}); err == nil {
+		t.Error("want error, got nil")
+	}
+	if _, err := OpenFile(filename, Options{Create: true, Mmap: true}); err == nil {
+		t.Error("want error, got nil")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("want not exist, got %v", err)
+	}
+}
@@ -0,0 +1,302 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"math/bits"
+	"math/rand"
+)
+
+// entry is a value in the store.
+// value and version are immutable. atime and hits are the statistics for eviction,
+// and they are updated atomically.
+type entry struct {
+	atime   int64
+	hits    int64
+	version int64
+	value   json.RawMessage
+}
+
+// hamt is a persistent hash array mapped trie.
+// A hamt is never modified; the updating methods return a new hamt sharing the unchanged nodes.
+// The zero value and the nil pointer are empty tries.
+type hamt struct {
+	root  *hamtNode
+	size  int
+	bytes int64 // total length of the values
+}
+
+const (
+	hamtBits  = 5
+	hamtWidth = 1 << hamtBits
+	hamtMask  = hamtWidth - 1
+
+	// the lowest bits of the hash are used for choosing the shard.
+	hamtShift = 5
+
+	// hamtMaxDepth is the depth where all bits of the hash are consumed.
+	// The nodes at this depth hold colliding keys in a list.
+	hamtMaxDepth = (64 - hamtShift) / hamtBits
+)
+
+type hamtNode struct {
+	// bitmap has a bit for each non-empty slot.
+	// slots holds the non-empty slots in the order of the bits.
+	// A collision node has no bitmap and holds leaves with the same hash.
+	bitmap uint32
+	slots  []hamtSlot
+}
+
+// hamtSlot is a leaf if child is nil, otherwise it is a sub-trie.
+type hamtSlot struct {
+	hash  uint64
+	key   string
+	value *entry
+	child *hamtNode
+}
+
+// hashKey returns the 64-bit FNV-1a hash of key.
+func hashKey(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+func hamtIndex(hash uint64, depth int) uint32 {
+	return uint32(hash>>(hamtShift+uint(depth)*hamtBits)) & hamtMask
+}
+
+// Len returns the number of keys.
+func (t *hamt) Len() int {
+	if t == nil {
+		return 0
+	}
+	return t.size
+}
+
+// Bytes returns the total length of the values.
+func (t *hamt) Bytes() int64 {
+	if t == nil {
+		return 0
+	}
+	return t.bytes
+}
+
+// Get returns the value for key.
+func (t *hamt) Get(key string, hash uint64) (*entry, bool) {
+	if t == nil {
+		return nil, false
+	}
+	n := t.root
+	for depth := 0; n != nil; depth++ {
+		if depth >= hamtMaxDepth {
+			for _, s := range n.slots {
+				if s.key == key {
+					return s.value, true
+				}
+			}
+			return nil, false
+		}
+		bit := uint32(1) << hamtIndex(hash, depth)
+		if n.bitmap&bit == 0 {
+			return nil, false
+		}
+		s := &n.slots[bits.OnesCount32(n.bitmap&(bit-1))]
+		if s.child == nil {
+			if s.key == key {
+				return s.value, true
+			}
+			return nil, false
+		}
+		n = s.child
+	}
+	return nil, false
+}
+
+// Set returns a new hamt with key set to value, and the old value if any.
+func (t *hamt) Set(key string, hash uint64, value *entry) (*hamt, *entry) {
+	var root *hamtNode
+	size, bytes := 0, int64(0)
+	if t != nil {
+		root, size, bytes = t.root, t.size, t.bytes
+	}
+	newRoot, old := root.set(key, hash, value, 0)
+	if old == nil {
+		size++
+	} else {
+		bytes -= int64(len(old.value))
+	}
+	bytes += int64(len(value.value))
+	return &hamt{root: newRoot, size: size, bytes: bytes}, old
+}
+
+func (n *hamtNode) set(key string, hash uint64, value *entry, depth int) (*hamtNode, *entry) {
+	leaf := hamtSlot{hash: hash, key: key, value: value}
+	if n == nil {
+		n = &hamtNode{}
+	}
+
+	if depth >= hamtMaxDepth {
+		// collision node
+		for i, s := range n.slots {
+			if s.key == key {
+				slots := append([]hamtSlot(nil), n.slots...)
+				slots[i] = leaf
+				return &hamtNode{slots: slots}, s.value
+			}
+		}
+		slots := make([]hamtSlot, len(n.slots), len(n.slots)+1)
+		copy(slots, n.slots)
+		return &hamtNode{slots: append(slots, leaf)}, nil
+	}
+
+	bit := uint32(1) << hamtIndex(hash, depth)
+	pos := bits.OnesCount32(n.bitmap & (bit - 1))
+	if n.bitmap&bit == 0 {
+		// insert a new leaf
+		slots := make([]hamtSlot, len(n.slots)+1)
+		copy(slots, n.slots[:pos])
+		slots[pos] = leaf
+		copy(slots[pos+1:], n.slots[pos:])
+		return &hamtNode{bitmap: n.bitmap | bit, slots: slots}, nil
+	}
+
+	s := n.slots[pos]
+	var replaced hamtSlot
+	var old *entry
+	switch {
+	case s.child != nil:
+		child, o := s.child.set(key, hash, value, depth+1)
+		replaced, old = hamtSlot{child: child}, o
+	case s.key == key:
+		replaced, old = leaf, s.value
+	default:
+		// split the leaf into a sub-trie
+		child, _ := (*hamtNode)(nil).set(s.key, s.hash, s.value, depth+1)
+		child, _ = child.set(key, hash, value, depth+1)
+		replaced = hamtSlot{child: child}
+	}
+	slots := append([]hamtSlot(nil), n.slots...)
+	slots[pos] = replaced
+	return &hamtNode{bitmap: n.bitmap, slots: slots}, old
+}
+
+// Delete returns a new hamt without key, and the deleted value if any.
+// If key does not exist, Delete returns t itself.
+func (t *hamt) Delete(key string, hash uint64) (*hamt, *entry) {
+	if t == nil {
+		return t, nil
+	}
+	newRoot, old := t.root.delete(key, hash, 0)
+	if old == nil {
+		return t, nil
+	}
+	return &hamt{root: newRoot, size: t.size - 1, bytes: t.bytes - int64(len(old.value))}, old
+}
+
+func (n *hamtNode) delete(key string, hash uint64, depth int) (*hamtNode, *entry) {
+	if n == nil {
+		return nil, nil
+	}
+
+	if depth >= hamtMaxDepth {
+		for i, s := range n.slots {
+			if s.key == key {
+				if len(n.slots) == 1 {
+					return nil, s.value
+				}
+				slots := make([]hamtSlot, 0, len(n.slots)-1)
+				slots = append(slots, n.slots[:i]...)
+				slots = append(slots, n.slots[i+1:]...)
+				return &hamtNode{slots: slots}, s.value
+			}
+		}
+		return n, nil
+	}
+
+	bit := uint32(1) << hamtIndex(hash, depth)
+	if n.bitmap&bit == 0 {
+		return n, nil
+	}
+	pos := bits.OnesCount32(n.bitmap & (bit - 1))
+	s := n.slots[pos]
+
+	if s.child == nil {
+		if s.key != key {
+			return n, nil
+		}
+		if len(n.slots) == 1 {
+			return nil, s.value
+		}
+		slots := make([]hamtSlot, 0, len(n.slots)-1)
+		slots = append(slots, n.slots[:pos]...)
+		slots = append(slots, n.slots[pos+1:]...)
+		return &hamtNode{bitmap: n.bitmap &^ bit, slots: slots}, s.value
+	}
+
+	child, old := s.child.delete(key, hash, depth+1)
+	if old == nil {
+		return n, nil
+	}
+	slots := append([]hamtSlot(nil), n.slots...)
+	switch {
+	case child == nil:
+		if len(n.slots) == 1 {
+			return nil, old
+		}
+		slots = append(slots[:pos], slots[pos+1:]...)
+		return &hamtNode{bitmap: n.bitmap &^ bit, slots: slots}, old
+	case len(child.slots) == 1 && child.slots[0].child == nil:
+		// pull up the last leaf of the sub-trie
+		slots[pos] = child.slots[0]
+	default:
+		slots[pos] = hamtSlot{child: child}
+	}
+	return &hamtNode{bitmap: n.bitmap, slots: slots}, old
+}
+
+// Range calls fn for each key and value until fn returns false.
+// It returns false if fn returns false.
+func (t *hamt) Range(fn func(key string, value *entry) bool) bool {
+	if t == nil {
+		return true
+	}
+	return t.root.each(fn)
+}
+
+func (n *hamtNode) each(fn func(key string, value *entry) bool) bool {
+	if n == nil {
+		return true
+	}
+	for i := range n.slots {
+		s := &n.slots[i]
+		if s.child != nil {
+			if !s.child.each(fn) {
+				return false
+			}
+			continue
+		}
+		if !fn(s.key, s.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Random returns a randomly chosen key and value.
+// It is not uniform: it descends the trie choosing a random slot at each level.
+func (t *hamt) Random() (string, *entry, bool) {
+	if t == nil || t.root == nil {
+		return "", nil, false
+	}
+	n := t.root
+	for {
+		s := &n.slots[rand.Intn(len(n.slots))]
+		if s.child == nil {
+			return s.key, s.value, true
+		}
+		n = s.child
+	}
+}
@@ -0,0 +1,103 @@
+package jsonstore
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestHAMT(t *testing.T) {
+	// hashes with few distinct values cause splits and collisions at all depths.
+	hashes := []func(key string) uint64{
+		hashKey,
+		func(key string) uint64 { return hashKey(key) & 0xff },
+		func(key string) uint64 { return hashKey(key) << 56 },
+		func(key string) uint64 { return 42 },
+	}
+	for i, hash := range hashes {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			testHAMT(t, hash)
+		})
+	}
+}
+
+func testHAMT(t *testing.T, hash func(string) uint64) {
+	r := rand.New(rand.NewSource(1))
+	want := map[string]*entry{}
+	var tree *hamt
+	for i := 0; i < 5000; i++ {
+		k := strconv.Itoa(r.Intn(500))
+		if r.Intn(3) == 0 {
+			var old *entry
+			tree, old = tree.Delete(k, hash(k))
+			if old != want[k] {
+				t.Fatalf("Delete(%s): want %v, got %v", k, want[k], old)
+			}
+			delete(want, k)
+		} else {
+			e := &entry{value: []byte(strconv.Itoa(i))}
+			var old *entry
+			tree, old = tree.Set(k, hash(k), e)
+			if old != want[k] {
+				t.Fatalf("Set(%s): want %v, got %v", k, want[k], old)
+			}
+			want[k] = e
+		}
+	}
+
+	if tree.Len() != len(want) {
+		t.Errorf("want %d, got %d", len(want), tree.Len())
+	}
+	for k, e := range want {
+		if got, ok := tree.Get(k, hash(k)); !ok || got != e {
+			t.Errorf("Get(%s): want %v, got %v", k, e, got)
+		}
+	}
+	if _, ok := tree.Get("missing", hash("missing")); ok {
+		t.Error("Get(missing): want not found")
+	}
+	seen := map[string]bool{}
+	tree.Range(func(key string, e *entry) bool {
+		if seen[key] {
+			t.Errorf("duplicated key %s", key)
+		}
+		seen[key] = true
+		if want[key] != e {
+			t.Errorf("Range(%s): want %v, got %v", key, want[key], e)
+		}
+		return true
+	})
+	if len(seen) != len(want) {
+		t.Errorf("want %d keys, got %d", len(want), len(seen))
+	}
+
+	// delete all
+	for k := range want {
+		tree, _ = tree.Delete(k, hash(k))
+	}
+	if tree.Len() != 0 || tree.root != nil {
+		t.Errorf("want empty tree, got %d keys", tree.Len())
+	}
+}
+
+func TestHAMTPersistent(t *testing.T) {
+	var v1 *hamt
+	for i := 0; i < 100; i++ {
+		v1, _ = v1.Set(key(i), hashKey(key(i)), &entry{value: []byte("1")})
+	}
+	v2, _ := v1.Set(key(0), hashKey(key(0)), &entry{value: []byte("2")})
+	v3, _ := v2.Delete(key(1), hashKey(key(1)))
+
+	if e, _ := v1.Get(key(0), hashKey(key(0))); string(e.value) != "1" {
+		t.Errorf("v1 is modified: %s", e.value)
+	}
+	if _, ok := v2.Get(key(1), hashKey(key(1))); !ok {
+		t.Error("v2 is modified")
+	}
+	if v1.Len() != 100 || v2.Len() != 100 || v3.Len() != 99 {
+		t.Errorf("unexpected sizes: %d, %d, %d", v1.Len(), v2.Len(), v3.Len())
+	}
+	if v4, _ := v3.Delete("missing", hashKey("missing")); v4 != v3 {
+		t.Error("deleting a missing key must not create a new version")
+	}
+}
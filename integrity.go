@@ -0,0 +1,216 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// CorruptionError is returned when a file is broken: it is truncated,
+// its checksum doesn't match, or it is not valid JSON.
+type CorruptionError struct {
+	Filename string
+	Reason   string
+	Err      error
+}
+
+func (err *CorruptionError) Error() string {
+	msg := "jsonstore: " + err.Filename + " is corrupt: " + err.Reason
+	if err.Err != nil {
+		msg += ": " + err.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (err *CorruptionError) Unwrap() error {
+	return err.Err
+}
+
+// The saved files end with a footer line after the JSON object:
+//
+//	{"$jsonstore":{"version":1,"count":3,"crc32c":"1a2b3c4d"}}
+//
+// The checksum is CRC-32C of the bytes before the footer line.
+// The footer is itself JSON, so the files are still readable by the tools which read a stream of JSON values.
+// The files without the footer are read without the verification.
+const (
+	footerPrefix  = `{"$jsonstore":`
+	footerVersion = 1
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type footer struct {
+	Jsonstore struct {
+		Version int    `json:"version"`
+		Count   int    `json:"count"`
+		CRC32C  string `json:"crc32c"`
+	} `json:"$jsonstore"`
+}
+
+type checksumWriter struct {
+	w    io.Writer
+	crc  uint32
+	last byte
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.crc = crc32.Update(w.crc, castagnoli, p[:n])
+	if n > 0 {
+		w.last = p[n-1]
+	}
+	return n, err
+}
+
+// writeWithFooter writes the snapshot and the footer.
+func writeWithFooter(w io.Writer, snapshot *snapshot) error {
+	cw := &checksumWriter{w: w}
+	if err := snapshot.writeTo(cw); err != nil {
+		return err
+	}
+	if cw.last != '\n' {
+		if _, err := cw.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	var f footer
+	f.Jsonstore.Version = footerVersion
+	f.Jsonstore.Count = snapshot.len()
+	f.Jsonstore.CRC32C = fmt.Sprintf("%08x", cw.crc)
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// verifyFooter verifies the checksum in the footer of b, and returns the content without the footer
+// and the entry count in the footer. The count is -1 if b has no footer.
+func verifyFooter(filename string, b []byte) ([]byte, int, error) {
+	data, f, err := splitFooter(filename, b)
+	if err != nil || f == nil {
+		return data, -1, err
+	}
+	if f.Jsonstore.Version != footerVersion {
+		return nil, 0, &CorruptionError{Filename: filename, Reason: "unsupported format version " + strconv.Itoa(f.Jsonstore.Version)}
+	}
+	if sum := fmt.Sprintf("%08x", crc32.Checksum(data, castagnoli)); sum != f.Jsonstore.CRC32C {
+		return nil, 0, &CorruptionError{
+			Filename: filename,
+			Reason:   fmt.Sprintf("checksum mismatch: want %s, got %s", f.Jsonstore.CRC32C, sum),
+		}
+	}
+	return data, f.Jsonstore.Count, nil
+}
+
+// verifyCount checks the number of the entries against the footer.
+func verifyCount(filename string, count, want int) error {
+	if want >= 0 && count != want {
+		return &CorruptionError{
+			Filename: filename,
+			Reason:   fmt.Sprintf("entry count mismatch: want %d, got %d", want, count),
+		}
+	}
+	return nil
+}
+
+// splitFooter splits b into the content and the footer. The footer is nil if b has no footer.
+func splitFooter(filename string, b []byte) ([]byte, *footer, error) {
+	i := bytes.LastIndex(b, []byte("\n"+footerPrefix))
+	if i < 0 {
+		return b, nil, nil
+	}
+	var f footer
+	if err := json.Unmarshal(b[i+1:], &f); err != nil {
+		return nil, nil, &CorruptionError{Filename: filename, Reason: "invalid footer", Err: err}
+	}
+	return b[:i+1], &f, nil
+}
+
+// readError converts an error while reading a file into CorruptionError,
+// unless it is an error of the file system or the decryption.
+func readError(filename string, err error) error {
+	if _, ok := err.(*os.PathError); ok || err == ErrCorrupt || err == ErrWrongKey {
+		return err
+	}
+	return &CorruptionError{Filename: filename, Reason: "failed to read", Err: err}
+}
+
+// Salvage loads all readable entries from a broken file.
+// It returns the store of the recovered entries with the error which describes the corruption,
+// or with nil if the file is not broken. The keys decrypt the file if it is encrypted.
+// The entries are recovered in the order in the file until the first broken one,
+// so a truncated file loses only its tail.
+func Salvage(filename string, keys ...*Key) (*JSONStore, error) {
+	f, r, err := openStream(filename, keys, defaultConfig.gzip(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// ReadAll returns the data read before an error.
+	b, err := ioutil.ReadAll(r)
+	var corruption error
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			return nil, err
+		}
+		corruption = &CorruptionError{Filename: filename, Reason: "failed to read", Err: err}
+	}
+	count := -1
+	if corruption == nil {
+		_, count, corruption = verifyFooter(filename, b)
+	}
+	if data, _, err := splitFooter(filename, b); err == nil {
+		b = data
+	}
+
+	entries, err := salvageEntries(b)
+	if err != nil && corruption == nil {
+		corruption = &CorruptionError{Filename: filename, Reason: "invalid JSON", Err: err}
+	}
+	if corruption == nil {
+		corruption = verifyCount(filename, len(entries), count)
+	}
+	return newJSONStore(entries, &defaultConfig), corruption
+}
+
+// salvageEntries decodes the entries of a JSON object until an error.
+func salvageEntries(b []byte) (map[string]json.RawMessage, error) {
+	entries := map[string]json.RawMessage{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	tok, err := dec.Token()
+	if err != nil {
+		return entries, err
+	}
+	if tok != json.Delim('{') {
+		return entries, fmt.Errorf("not an object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return entries, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return entries, fmt.Errorf("unexpected token %v", tok)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return entries, err
+		}
+		entries[key] = value
+	}
+	if _, err := dec.Token(); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
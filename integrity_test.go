@@ -0,0 +1,139 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "foo.jsonstore")
+	ks := new(JSONStore)
+	ks.Set("hello", "world")
+	ks.Set("foo", 1234)
+	if err := Save(ks, filename); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `{"$jsonstore":{"version":1,"count":2,"crc32c":"`) {
+		t.Errorf("no footer: %s", b)
+	}
+	if _, err := Open(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"tampered":  strings.Replace(string(b), "1234", "4321", 1),
+		"truncated": string(b[:len(b)-5]),
+		"count":     strings.Replace(string(b), `"count":2`, `"count":3`, 1),
+		"version":   strings.Replace(string(b), `"version":1`, `"version":2`, 1),
+		"no footer": string(b[:strings.Index(string(b), "\n")-1]),
+	}
+	for name, data := range tests {
+		ioutil.WriteFile(filename, []byte(data), 0644)
+		_, err := Open(filename)
+		if _, ok := err.(*CorruptionError); !ok {
+			t.Errorf("%s: want *CorruptionError, got %v", name, err)
+		}
+	}
+
+	// the files without the footer are not verified.
+	ioutil.WriteFile(filename, []byte(`{"hello":"world"}`), 0644)
+	if _, err := Open(filename); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChecksum_Gzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "foo.jsonstore.gz")
+	ks := new(JSONStore)
+	for i := 0; i < 1000; i++ {
+		ks.Set("key:"+strconv.Itoa(i), strings.Repeat("x", i))
+	}
+	if err := Save(ks, filename); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filename, b[:len(b)/2], 0644)
+	_, err = Open(filename)
+	if _, ok := err.(*CorruptionError); !ok {
+		t.Errorf("want *CorruptionError, got %v", err)
+	}
+
+	ks2, err := Salvage(filename)
+	if _, ok := err.(*CorruptionError); !ok {
+		t.Errorf("want *CorruptionError, got %v", err)
+	}
+	if ks2.Size() == 0 || ks2.Size() >= 1000 {
+		t.Errorf("want some entries, got %d", ks2.Size())
+	}
+	ks2.Range(func(key string, value json.RawMessage) bool {
+		want, _ := ks.GetRawUnsafe(key)
+		if string(value) != string(want) {
+			t.Errorf("%s: want %s, got %s", key, want, value)
+		}
+		return true
+	})
+}
+
+func TestSalvage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "foo.jsonstore")
+	ioutil.WriteFile(filename, []byte(`{"a":1,"b":{"c":[1,2]},"d":"trunc`), 0644)
+	ks, err := Salvage(filename)
+	if _, ok := err.(*CorruptionError); !ok {
+		t.Errorf("want *CorruptionError, got %v", err)
+	}
+	if got, want := storeData(ks), map[string]string{"a": "1", "b": `{"c":[1,2]}`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	ks = new(JSONStore)
+	ks.Set("a", 1)
+	if err := Save(ks, filename); err != nil {
+		t.Fatal(err)
+	}
+	if ks, err := Salvage(filename); err != nil || ks.Size() != 1 {
+		t.Errorf("want 1 entry and nil, got %d entries and %v", ks.Size(), err)
+	}
+
+	// the entries are salvaged even if the checksum is wrong.
+	b, _ := ioutil.ReadFile(filename)
+	ioutil.WriteFile(filename, bytes.Replace(b, []byte(`"a":1`), []byte(`"a":2`), 1), 0644)
+	ks, err = Salvage(filename)
+	if _, ok := err.(*CorruptionError); !ok {
+		t.Errorf("want *CorruptionError, got %v", err)
+	}
+	if got, want := storeData(ks), map[string]string{"a": "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
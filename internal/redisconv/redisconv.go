@@ -0,0 +1,24 @@
+// Package redisconv converts the values between Redis and JSONStore,
+// and matches the keys with the glob-style patterns of Redis.
+// It is shared by jsonstoreresp and jsonstoreredis.
+package redisconv
+
+import "encoding/json"
+
+// ToJSON converts a Redis string into a JSON string, so it round-trips through FromJSON.
+func ToJSON(b []byte) json.RawMessage {
+	s, _ := json.Marshal(string(b))
+	return s
+}
+
+// FromJSON converts a JSON value into a Redis string.
+// A JSON string is decoded, and other values are JSON text.
+func FromJSON(raw json.RawMessage) []byte {
+	if len(raw) > 0 && raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return []byte(s)
+		}
+	}
+	return raw
+}
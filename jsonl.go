@@ -0,0 +1,235 @@
+package jsonstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImportResult is the result of a bulk import.
+type ImportResult struct {
+	// Imported is the number of the imported records.
+	// In the dry-run mode, it is the number of the records which would be imported.
+	Imported int
+
+	// Errors is the errors of the skipped records.
+	Errors []*LineError
+}
+
+// LineError is an error of a record in a bulk import.
+type LineError struct {
+	// Line is the line number of the record, starting at 1.
+	Line int
+
+	// Key is the key of the record, or empty if it is unknown.
+	Key string
+
+	Err error
+}
+
+func (err *LineError) Error() string {
+	if err.Key == "" {
+		return fmt.Sprintf("jsonstore: line %d: %v", err.Line, err.Err)
+	}
+	return fmt.Sprintf("jsonstore: line %d: key %q: %v", err.Line, err.Key, err.Err)
+}
+
+// JSONLOptions is the options of ImportJSONL and ExportJSONL.
+type JSONLOptions struct {
+	// KeyField is the name of the field which has the key. Empty means "key".
+	KeyField string
+
+	// ValueField is the name of the field which has the value. Empty means "value".
+	ValueField string
+
+	// Embed makes the record the value itself: the key field is removed from the record on import,
+	// and it is added to the value on export. The values must be objects.
+	Embed bool
+
+	// KeyPrefix is added to the keys on import, and removed from the keys on export.
+	// On export, only the keys with KeyPrefix are written.
+	KeyPrefix string
+
+	// DryRun validates the records without saving them.
+	DryRun bool
+}
+
+func (opts *JSONLOptions) keyField() string {
+	if opts.KeyField == "" {
+		return "key"
+	}
+	return opts.KeyField
+}
+
+func (opts *JSONLOptions) valueField() string {
+	if opts.ValueField == "" {
+		return "value"
+	}
+	return opts.ValueField
+}
+
+// ImportJSONL imports JSON Lines from r, which has a JSON object for a record in each line.
+// The records are read one by one, so the input is not loaded into memory at once.
+// The invalid records are skipped, and they are reported in ImportResult.Errors.
+// The error is not nil only if reading r fails.
+func (s *JSONStore) ImportJSONL(r io.Reader, opts JSONLOptions) (ImportResult, error) {
+	var result ImportResult
+	if !opts.DryRun && s.getConfig().readOnly {
+		return result, ErrReadOnly
+	}
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		b, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(b)) > 0 {
+			key, value, rerr := parseJSONL(b, &opts)
+			if rerr == nil {
+				rerr = s.importValue(key, value, opts.DryRun)
+			}
+			if rerr != nil {
+				result.Errors = append(result.Errors, &LineError{Line: line, Key: key, Err: rerr})
+			} else {
+				result.Imported++
+			}
+		}
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+}
+
+func parseJSONL(b []byte, opts *JSONLOptions) (string, []byte, error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(b, &record); err != nil {
+		return "", nil, err
+	}
+	rawKey, ok := record[opts.keyField()]
+	if !ok {
+		return "", nil, fmt.Errorf("no %q field", opts.keyField())
+	}
+	var key string
+	if err := json.Unmarshal(rawKey, &key); err != nil {
+		// numbers are used as keys as written.
+		var n json.Number
+		if err := json.Unmarshal(rawKey, &n); err != nil {
+			return "", nil, fmt.Errorf("invalid key %s", rawKey)
+		}
+		key = n.String()
+	}
+	key = opts.KeyPrefix + key
+
+	if opts.Embed {
+		delete(record, opts.keyField())
+		value, err := json.Marshal(record)
+		return key, value, err
+	}
+	value, ok := record[opts.valueField()]
+	if !ok {
+		return key, nil, fmt.Errorf("no %q field", opts.valueField())
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err != nil {
+		return key, nil, err
+	}
+	return key, buf.Bytes(), nil
+}
+
+// importValue saves a value of a bulk import, or validates it in the dry-run mode.
+func (s *JSONStore) importValue(key string, value []byte, dryRun bool) error {
+	if !dryRun {
+		return s.set(key, value)
+	}
+	schemas := s.getConfig().schemas
+	if len(schemas) > 0 {
+		if err := validateValue(schemas, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportJSONL writes the store to w as JSON Lines.
+// It writes a snapshot line by line while iterating it, so the store can be modified during the export,
+// and the order of the lines is not specified.
+func (s *JSONStore) ExportJSONL(w io.Writer, opts JSONLOptions) error {
+	keyField, err := json.Marshal(opts.keyField())
+	if err != nil {
+		return err
+	}
+	valueField, err := json.Marshal(opts.valueField())
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	var value bytes.Buffer
+	s.snapshot(false).each(func(key string, e *entry) bool {
+		if !strings.HasPrefix(key, opts.KeyPrefix) {
+			return true
+		}
+		var k []byte
+		k, err = json.Marshal(key[len(opts.KeyPrefix):])
+		if err != nil {
+			return false
+		}
+		// the values may be indented, but a line must hold a whole value.
+		value.Reset()
+		if err = json.Compact(&value, e.value); err != nil {
+			return false
+		}
+		bw.WriteByte('{')
+		bw.Write(keyField)
+		bw.WriteByte(':')
+		bw.Write(k)
+		if opts.Embed {
+			if err = writeEmbedded(bw, key, value.Bytes(), opts.keyField()); err != nil {
+				return false
+			}
+		} else {
+			bw.WriteByte(',')
+			bw.Write(valueField)
+			bw.WriteByte(':')
+			bw.Write(value.Bytes())
+		}
+		_, err = bw.WriteString("}\n")
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeEmbedded writes the members of value after the key field. value must be compact.
+func writeEmbedded(w *bufio.Writer, key string, value json.RawMessage, keyField string) error {
+	var members map[string]json.RawMessage
+	if !isJSONObject(value) || json.Unmarshal(value, &members) != nil {
+		return fmt.Errorf("jsonstore: key %q: the value is not an object", key)
+	}
+	if _, ok := members[keyField]; ok {
+		return fmt.Errorf("jsonstore: key %q: the value has the key field %s", key, strconv.Quote(keyField))
+	}
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		n, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		w.WriteByte(',')
+		w.Write(n)
+		w.WriteByte(':')
+		w.Write(members[name])
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package jsonstore
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestImportJSONL(t *testing.T) {
+	in := `{"key":"a","value":{"x": 1}}
+{"key":2,"value":[1, 2]}
+
+{"key":"c"}
+not json
+{"value":1}
+{"key":"d","value":"last"}`
+	ks := newStoreFromJSON(t, `{}`)
+	result, err := ks.ImportJSONL(strings.NewReader(in), JSONLOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 3 {
+		t.Errorf("want %d, got %d", 3, result.Imported)
+	}
+	var lines []int
+	for _, err := range result.Errors {
+		lines = append(lines, err.Line)
+	}
+	if want := []int{4, 5, 6}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("want %v, got %v", want, lines)
+	}
+
+	want := map[string]string{
+		"a": `{"x":1}`,
+		"2": `[1,2]`,
+		"d": `"last"`,
+	}
+	if got := storeData(ks); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestImportJSONL_DryRun(t *testing.T) {
+	in := `{"id":"1","Name":"Dante","Height":5.4}
+{"id":"2","Name":"Virgil","Height":-1}
+`
+	ks := newStoreFromJSON(t, `{}`)
+	ks.RegisterSchemaPrefix("human:", MustCompileSchema([]byte(humanSchema)))
+	opts := JSONLOptions{KeyField: "id", Embed: true, KeyPrefix: "human:", DryRun: true}
+	result, err := ks.ImportJSONL(strings.NewReader(in), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 || len(result.Errors) != 1 || result.Errors[0].Line != 2 {
+		t.Errorf("want an error at line 2, got %d imported, %v", result.Imported, result.Errors)
+	}
+	if ks.Size() != 0 {
+		t.Errorf("want %d, got %d", 0, ks.Size())
+	}
+
+	opts.DryRun = false
+	if _, err := ks.ImportJSONL(strings.NewReader(in), opts); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"human:1": `{"Height":5.4,"Name":"Dante"}`}
+	if got := storeData(ks); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	ks := newStoreFromJSON(t, `{"b":[1,2],"a":{"x":1},"other:c":"c"}`)
+	var buf bytes.Buffer
+	if err := ks.ExportJSONL(&buf, JSONLOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`{"key":"a","value":{"x":1}}`,
+		`{"key":"b","value":[1,2]}`,
+		`{"key":"other:c","value":"c"}`,
+	}
+	// the order of the lines is not specified.
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	// round trip
+	ks2 := newStoreFromJSON(t, `{}`)
+	if _, err := ks2.ImportJSONL(&buf, JSONLOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := storeData(ks2), storeData(ks); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestExportJSONL_Indent(t *testing.T) {
+	ks := newStoreFromJSON(t, `{
+  "a": {
+    "x": [1, 2]
+  }
+}`)
+	ks.SetEncodeOptions(EncodeOptions{Indent: "  "})
+	ks.Set("b", map[string]int{"y": 3})
+
+	for _, opts := range []JSONLOptions{{}, {Embed: true}} {
+		var buf bytes.Buffer
+		if err := ks.ExportJSONL(&buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(buf.String(), "\n"); n != 2 {
+			t.Errorf("%v: want %d lines, got %d: %q", opts.Embed, 2, n, buf.String())
+		}
+
+		// round trip
+		ks2 := newStoreFromJSON(t, `{}`)
+		result, err := ks2.ImportJSONL(&buf, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Errors) != 0 {
+			t.Errorf("%v: want no errors, got %v", opts.Embed, result.Errors)
+		}
+		want := map[string]string{"a": `{"x":[1,2]}`, "b": `{"y":3}`}
+		if got := storeData(ks2); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: want %v, got %v", opts.Embed, want, got)
+		}
+	}
+}
+
+func TestExportJSONL_Embed(t *testing.T) {
+	ks := newStoreFromJSON(t, `{"human:1":{"Name":"Dante","Height":5.4},"other":1}`)
+	var buf bytes.Buffer
+	opts := JSONLOptions{KeyField: "id", KeyPrefix: "human:", Embed: true}
+	if err := ks.ExportJSONL(&buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":"1","Height":5.4,"Name":"Dante"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("want %q, got %q", want, buf.String())
+	}
+
+	opts.KeyPrefix = ""
+	if err := ks.ExportJSONL(&buf, opts); err == nil {
+		t.Error("want error, got nil")
+	}
+}
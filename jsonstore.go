@@ -1,81 +1,245 @@
 package jsonstore
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
-	"strings"
+	"path/filepath"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // NoSuchKeyError is thrown when calling Get with invalid key
 type NoSuchKeyError struct {
-	key string
+	Key string
 }
 
 func (err NoSuchKeyError) Error() string {
-	return "jsonstore: no such key \"" + err.key + "\""
+	return "jsonstore: no such key \"" + err.Key + "\""
 }
 
 // JSONStore is the basic store object.
 type JSONStore struct {
-	data       map[string]*json.RawMessage
+	// setCount and savedCount are accessed atomically.
+	// They are placed first to keep them 64-bit aligned.
+	setCount     int64
+	savedCount   int64
+	evictions    int64
+	evictedBytes int64
+	clock        int64 // the last version assigned to an entry
+
+	shards   [shardCount]shard
+	config   atomic.Value // *config
+	notifier notifier
+	stop     chan struct{}
+	done     chan struct{}
+
+	reloadStop chan struct{}
+	reloadDone chan struct{}
+	reload     *reloadState
+
+	// RWMutex guards the updates of config, auto saving and hot reloading.
+	sync.RWMutex
+}
+
+// config is the settings of a JSONStore.
+// It is immutable once it is stored into JSONStore.config.
+type config struct {
+	codec      Codec
+	decodeOpts DecodeOptions
+	encodeOpts EncodeOptions
+	schemas    []schemaEntry
+	limits     Limits
+	key        *Key   // the key to encrypt files, or nil
+	keys       []*Key // the keys to decrypt the file opened by OpenFile
+	format     Format
+	mode       os.FileMode // the permission of the saved files, or zero for 0666
+	sync       bool        // sync the saved files to the disk
+	filename   string      // the file opened by OpenFile
+	sensitive  []sensitiveEntry
+	lock       *FileLock // the lock taken by Options.Lock, or nil
+	readOnly   bool
+	shared     *sharedFile // the data shared by the read-only stores, or nil
 	diffCount  int64
-	setCount   int64
-	savedCount int64
 	save       chan struct{}
-	stop       chan struct{}
-	done       chan struct{}
-	sync.RWMutex
+}
+
+var defaultConfig config
+
+func (c *config) getCodec() Codec {
+	if c.codec == nil {
+		return DefaultCodec
+	}
+	return c.codec
+}
+
+// getConfig returns the current settings of the store.
+func (s *JSONStore) getConfig() *config {
+	if c, ok := s.config.Load().(*config); ok {
+		return c
+	}
+	return &defaultConfig
+}
+
+// updateConfig updates the settings of the store with fn.
+func (s *JSONStore) updateConfig(fn func(c *config)) {
+	s.Lock()
+	defer s.Unlock()
+	c := *s.getConfig()
+	fn(&c)
+	s.config.Store(&c)
+}
+
+// newJSONStore returns a new store which has data and the settings of c except auto saving.
+func newJSONStore(data map[string]json.RawMessage, c *config) *JSONStore {
+	var trees [shardCount]*hamt
+	for k, v := range data {
+		hash := hashKey(k)
+		i := shardIndex(hash)
+		trees[i], _ = trees[i].Set(k, hash, &entry{value: v, version: 1})
+	}
+	s := newJSONStoreFromTrees(trees, 0, c)
+	s.clock = 1
+	return s
+}
+
+// newJSONStoreFromTrees returns a new store which shares trees.
+func newJSONStoreFromTrees(trees [shardCount]*hamt, setCount int64, c *config) *JSONStore {
+	s := &JSONStore{setCount: setCount}
+	for i, t := range trees {
+		s.shards[i].tree.Store(t)
+	}
+	cc := *c
+	cc.diffCount = 0
+	cc.save = nil
+	cc.lock = nil // the lock is owned by the store which took it
+	cc.shared = nil
+	cc.readOnly = false
+	cc.filename = "" // a copy must not overwrite the file of the original store
+	s.config.Store(&cc)
+	return s
 }
 
 // Open will load a jsonstore from a file.
+//
+// Deprecated: Use OpenFile.
 func Open(filename string) (*JSONStore, error) {
-	// load from file
-	f, err := os.Open(filename)
+	return OpenFile(filename, Options{})
+}
+
+// openFile loads a jsonstore from a file, and decrypts it with keys if keys is not empty.
+func openFile(filename string, cfg *config, keys []*Key) (*JSONStore, error) {
+	f, r, err := openStream(filename, keys, cfg.gzip(filename))
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	// decode gzip if filename has ".gz" suffix
-	var r io.ReadCloser = f
-	if strings.HasSuffix(filename, ".gz") {
-		r, err = gzip.NewReader(f)
-		if err != nil {
-			return nil, err
-		}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, readError(filename, err)
+	}
+	b, count, err := verifyFooter(filename, b)
+	if err != nil {
+		return nil, err
 	}
 
 	// decode json
-	dec := json.NewDecoder(r)
-	var data map[string]*json.RawMessage
+	dec := cfg.getCodec().NewDecoder(bytes.NewReader(b))
+	var data map[string]json.RawMessage
 	if err := dec.Decode(&data); err != nil {
+		return nil, &CorruptionError{Filename: filename, Reason: "invalid JSON", Err: err}
+	}
+	if err := verifyCount(filename, len(data), count); err != nil {
 		return nil, err
 	}
-	return &JSONStore{data: data}, nil
+	return newJSONStore(data, cfg), nil
+}
+
+// openStream opens a file, and returns the reader of the decrypted and decompressed content.
+func openStream(filename string, keys []*Key, gz bool) (*os.File, io.Reader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// decrypt
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if len(keys) > 0 {
+		r, err = newDecryptReader(br, keys)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+	} else if isEncrypted(br) {
+		f.Close()
+		return nil, nil, ErrWrongKey
+	}
+
+	// decode gzip
+	if gz {
+		r, err = gzip.NewReader(r)
+		if err != nil {
+			f.Close()
+			return nil, nil, readError(filename, err)
+		}
+	}
+	return f, r, nil
 }
 
 // Save writes the jsonstore to disk.
+// Like SaveAndRename, it replaces the file instead of rewriting it,
+// because the read-only stores may map the file into memory.
 func Save(ks *JSONStore, filename string) error {
-	return save(ks, filename, true)
+	return ks.saveTo(ks.snapshot(false), filename)
 }
 
-func save(ks *JSONStore, filename string, takeSnapshot bool) error {
-	f, err := os.Create(filename)
+// writeFile writes the snapshot to filename, and compresses it if gz is true.
+func writeFile(snapshot *snapshot, filename string, gz bool) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, snapshot.config.fileMode())
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	var w io.WriteCloser = f
-	if strings.HasSuffix(filename, ".gz") {
-		w = gzip.NewWriter(f)
-		defer w.Close()
+	// the layers are closed in reverse order to flush them.
+	var w io.Writer = f
+	var closers []io.Closer
+	if key := snapshot.config.key; key != nil {
+		ew, err := newEncryptWriter(w, key)
+		if err != nil {
+			return err
+		}
+		w = ew
+		closers = append(closers, ew)
+	}
+	if gz {
+		gw := gzip.NewWriter(w)
+		w = gw
+		closers = append(closers, gw)
+	}
+	if err := writeWithFooter(w, snapshot); err != nil {
+		return err
 	}
-	return ks.saveToWriter(w, takeSnapshot)
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			return err
+		}
+	}
+	if snapshot.config.sync {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	return f.Close()
 }
 
 // SaveAndRename writes the jsonstore to disk more safely.
@@ -83,39 +247,87 @@ func save(ks *JSONStore, filename string, takeSnapshot bool) error {
 // and then rename it to filename.
 // NOTE: os.Rename renames atomic on POSIX systems, but no guarantee on other systems.
 func SaveAndRename(ks *JSONStore, filename string) error {
-	return saveAndRename(ks, filename, true)
+	return ks.saveTo(ks.snapshot(false), filename)
 }
 
-func saveAndRename(ks *JSONStore, filename string, takeSnapshot bool) error {
-	tmpfile := fmt.Sprintf("%s.tmp-%d", filename, time.Now().Unix())
-	if strings.HasSuffix(filename, ".gz") {
-		tmpfile += ".gz"
+// tmpCount makes the names of the temporary files unique when the saves run at the same time.
+var tmpCount uint64
+
+func saveAndRename(snapshot *snapshot, filename string) error {
+	if err := snapshot.config.lock.checkWrite(filename); err != nil {
+		return err
 	}
+	tmpfile := fmt.Sprintf("%s.tmp-%d-%d", filename, time.Now().Unix(), atomic.AddUint64(&tmpCount, 1))
 	defer os.Remove(tmpfile)
-	err := save(ks, tmpfile, takeSnapshot)
+	err := writeFile(snapshot, tmpfile, snapshot.config.gzip(filename))
 	if err != nil {
 		return err
 	}
-	return os.Rename(tmpfile, filename)
+	if err := os.Rename(tmpfile, filename); err != nil {
+		return err
+	}
+	if snapshot.config.sync {
+		return syncDir(filepath.Dir(filename))
+	}
+	return nil
+}
+
+// snapshot is the data of a JSONStore at a moment.
+// It shares the immutable tries with the store, so taking a snapshot is cheap.
+type snapshot struct {
+	trees    [shardCount]*hamt
+	setCount int64
+	config   *config
 }
 
-// SaveToWriter writes the jsonstore to io.Writer
-func (s *JSONStore) saveToWriter(w io.Writer, takeSnapshot bool) error {
-	snapshot := s
-	if takeSnapshot {
-		snapshot = s.snapshot(false)
+// each calls fn for each key and value until fn returns false.
+func (snapshot *snapshot) each(fn func(key string, e *entry) bool) {
+	for _, t := range snapshot.trees {
+		if !t.Range(fn) {
+			return
+		}
 	}
-	enc := json.NewEncoder(w)
-	return enc.Encode(snapshot.data)
+}
+
+func (snapshot *snapshot) len() int {
+	n := 0
+	for _, t := range snapshot.trees {
+		n += t.Len()
+	}
+	return n
+}
+
+// data returns the data of the snapshot as a map.
+func (snapshot *snapshot) data() map[string]json.RawMessage {
+	data := make(map[string]json.RawMessage, snapshot.len())
+	snapshot.each(func(key string, e *entry) bool {
+		data[key] = e.value
+		return true
+	})
+	return data
+}
+
+// writeTo writes the snapshot to io.Writer
+func (snapshot *snapshot) writeTo(w io.Writer) error {
+	enc := snapshot.config.getCodec().NewEncoder(w)
+	return enc.Encode(snapshot.data())
 }
 
 // StartAutoSave starts auto saving.
+// It does nothing for read-only stores.
 func (s *JSONStore) StartAutoSave(filename string, d time.Duration, count int64) {
+	if s.getConfig().readOnly {
+		return
+	}
+	saveCh := make(chan struct{}, 1)
+	s.updateConfig(func(c *config) {
+		c.diffCount = count
+		c.save = saveCh
+	})
 	s.Lock()
-	s.diffCount = count
-	s.save = make(chan struct{}, 1)
 	s.stop = make(chan struct{}, 1)
 	s.done = make(chan struct{}, 1)
+	stop, done := s.stop, s.done
 	s.Unlock()
 
 	go func() {
@@ -129,10 +341,10 @@ func (s *JSONStore) StartAutoSave(filename string, d time.Duration, count int64)
 		loop := true
 		for loop {
 			select {
-			case <-s.stop:
+			case <-stop:
 				// when StopAutoSave() called
 				loop = false
-			case <-s.save:
+			case <-saveCh:
 				// when `count` changes occur
 			case <-c:
 				// the ticks are delivered
@@ -141,110 +353,228 @@ func (s *JSONStore) StartAutoSave(filename string, d time.Duration, count int64)
 			if snapshot == nil {
 				continue
 			}
-			save(snapshot, filename, false)
-			s.Lock()
-			s.savedCount = snapshot.setCount
-			s.Unlock()
+			s.saveTo(snapshot, filename)
+			atomic.StoreInt64(&s.savedCount, snapshot.setCount)
 		}
-		close(s.done)
+		close(done)
 	}()
 }
 
 // StopAutoSave stops auto saving.
 func (s *JSONStore) StopAutoSave() {
-	close(s.stop)
-	<-s.done // wait for saving goroutine
+	s.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done // wait for saving goroutine
 }
 
 // Set saves a value at the given key.
 func (s *JSONStore) Set(key string, value interface{}) error {
-	b, err := json.Marshal(value)
+	c := s.getConfig()
+	b, err := c.getCodec().Marshal(value, c.encodeOpts)
 	if err != nil {
 		return err
 	}
+	return s.set(key, b)
+}
 
-	s.Lock()
-	defer s.Unlock()
-	if s.data == nil {
-		s.data = make(map[string]*json.RawMessage)
+// set stores b at the given key. b must be valid JSON and must not be modified after the call.
+func (s *JSONStore) set(key string, b []byte) error {
+	_, err := s.setVersion(key, b, AnyVersion)
+	return err
+}
+
+// setVersion saves b at key if the current version of key is version,
+// and returns the new version.
+func (s *JSONStore) setVersion(key string, b []byte, version int64) (int64, error) {
+	c := s.getConfig()
+	if c.readOnly {
+		return 0, ErrReadOnly
+	}
+	return s.write(c, key, b, version)
+}
+
+// write is setVersion without checking the read-only mode.
+func (s *JSONStore) write(c *config, key string, b []byte, version int64) (int64, error) {
+	b, err := c.openFields(key, b)
+	if err != nil {
+		return 0, err
+	}
+	if len(c.schemas) > 0 {
+		if err := validateValue(c.schemas, key, b); err != nil {
+			return 0, err
+		}
+	}
+	b, err = c.encryptFields(key, b)
+	if err != nil {
+		return 0, err
 	}
-	s.data[key] = (*json.RawMessage)(&b)
-	s.setCount++
-	if s.diffCount != 0 && s.setCount-s.savedCount >= s.diffCount {
+
+	e := &entry{value: b}
+	if c.limits.enabled() {
+		e.touch()
+	}
+	hash := hashKey(key)
+	sh := s.shardFor(hash)
+	sh.mu.Lock()
+	t := sh.load()
+	if version != AnyVersion && versionOf(t.Get(key, hash)) != version {
+		sh.mu.Unlock()
+		return 0, ErrVersionMismatch
+	}
+	e.version = atomic.AddInt64(&s.clock, 1)
+	t, old := t.Set(key, hash, e)
+	sh.tree.Store(t)
+	s.changed(c)
+	ev := Event{Type: EventSet, Key: key, New: b}
+	if old != nil {
+		ev.Old = c.detach(old.value)
+	}
+	hooks := s.notifier.publish(ev)
+	sh.mu.Unlock()
+
+	callHooks(hooks, ev)
+	s.evict(c, key)
+	return e.version, nil
+}
+
+// changed counts a change, and triggers auto saving if needed.
+// It must be called while the shard of the changed key is locked,
+// so that snapshots see the count consistent with the data.
+func (s *JSONStore) changed(c *config) {
+	setCount := atomic.AddInt64(&s.setCount, 1)
+	if c.diffCount != 0 && setCount-atomic.LoadInt64(&s.savedCount) >= c.diffCount {
 		select {
-		case s.save <- struct{}{}:
+		case c.save <- struct{}{}:
 		default:
 		}
 	}
-	return nil
 }
 
 // Get will return the value associated with a key.
 func (s *JSONStore) Get(key string, v interface{}) error {
-	s.RLock()
-	b, ok := s.data[key]
-	s.RUnlock()
-	if !ok {
-		return NoSuchKeyError{key}
+	b, err := s.GetRawUnsafe(key)
+	if err != nil {
+		return err
 	}
-	return json.Unmarshal(*b, v)
+	c := s.getConfig()
+	return unmarshal(c.getCodec(), b, v, c.decodeOpts)
 }
 
 // GetAll is like a filter with a regexp.
+// The store returned for a read-only store keeps the shared memory until it is closed.
 func (s *JSONStore) GetAll(matcher func(key string) bool) *JSONStore {
 	s.RLock()
 	defer s.RUnlock()
-	results := make(map[string]*json.RawMessage)
-	for k, v := range s.data {
-		if matcher == nil || matcher(k) {
-			results[k] = v
+	trees, setCount := s.trees()
+	if matcher != nil {
+		for i, t := range trees {
+			var filtered *hamt
+			t.Range(func(key string, e *entry) bool {
+				if matcher(key) {
+					filtered, _ = filtered.Set(key, hashKey(key), e)
+				}
+				return true
+			})
+			trees[i] = filtered
 		}
 	}
-	return &JSONStore{
-		data:     results,
-		setCount: s.setCount,
+	c := s.getConfig()
+	gs := newJSONStoreFromTrees(trees, setCount, c)
+	gs.clock = atomic.LoadInt64(&s.clock)
+	if sf := c.shared; sf != nil {
+		// the values may refer to the mapped memory.
+		sf.acquire()
+		gs.updateConfig(func(c *config) {
+			c.shared = sf
+		})
+		runtime.SetFinalizer(gs, (*JSONStore).Close)
 	}
+	return gs
 }
 
-func (s *JSONStore) snapshot(skipIfSaved bool) *JSONStore {
-	s.RLock()
-	defer s.RUnlock()
-	if skipIfSaved && s.setCount == s.savedCount {
+func (s *JSONStore) snapshot(skipIfSaved bool) *snapshot {
+	trees, setCount := s.trees()
+	if skipIfSaved && setCount == atomic.LoadInt64(&s.savedCount) {
 		return nil
 	}
-	results := make(map[string]*json.RawMessage)
-	for k, v := range s.data {
-		results[k] = v
-	}
-	return &JSONStore{
-		data:     results,
-		setCount: s.setCount,
+	return &snapshot{
+		trees:    trees,
+		setCount: setCount,
+		config:   s.getConfig(),
 	}
 }
 
 // Keys returns all the keys currently in map
 func (s *JSONStore) Keys() []string {
-	s.RLock()
-	defer s.RUnlock()
-	keys := make([]string, len(s.data))
-	i := 0
-	for k := range s.data {
-		keys[i] = k
-		i++
-	}
+	snapshot := &snapshot{trees: s.loadTrees()}
+	keys := make([]string, 0, snapshot.len())
+	snapshot.each(func(key string, e *entry) bool {
+		keys = append(keys, key)
+		return true
+	})
 	return keys
 }
 
+// Range calls fn for each key and value until fn returns false.
+// It iterates over the shards loaded at the call without blocking the writers, so fn may modify the store.
+// Use Snapshot for a consistent view of the store.
+// The order is not specified. value is shared with the store, so fn MUST NOT modify it.
+func (s *JSONStore) Range(fn func(key string, value json.RawMessage) bool) {
+	snapshot := &snapshot{trees: s.loadTrees()}
+	snapshot.each(func(key string, e *entry) bool {
+		return fn(key, e.value)
+	})
+}
+
 // Delete removes a key from the store.
+// It does nothing for read-only stores, because it can't report ErrReadOnly.
+// Use CompareAndDelete with AnyVersion to know whether the key is removed.
 func (s *JSONStore) Delete(key string) {
-	s.Lock()
-	defer s.Unlock()
-	delete(s.data, key)
+	if s.getConfig().readOnly {
+		return
+	}
+	s.remove(key, EventDelete, AnyVersion)
+}
+
+// remove removes a key from the store if the current version of key is version,
+// and returns the removed value.
+// typ is the type of the event published for the change.
+func (s *JSONStore) remove(key string, typ EventType, version int64) (*entry, error) {
+	hash := hashKey(key)
+	sh := s.shardFor(hash)
+	sh.mu.Lock()
+	t := sh.load()
+	if version != AnyVersion && versionOf(t.Get(key, hash)) != version {
+		sh.mu.Unlock()
+		return nil, ErrVersionMismatch
+	}
+	t, old := t.Delete(key, hash)
+	if old == nil {
+		sh.mu.Unlock()
+		return nil, nil
+	}
+	sh.tree.Store(t)
+	c := s.getConfig()
+	s.changed(c)
+	ev := Event{Type: typ, Key: key, Old: c.detach(old.value)}
+	hooks := s.notifier.publish(ev)
+	sh.mu.Unlock()
+
+	callHooks(hooks, ev)
+	return old, nil
 }
 
 // Size returns the count element in the store.
 func (s *JSONStore) Size() int {
-	s.RLock()
-	defer s.RUnlock()
-	return len(s.data)
+	n := 0
+	for i := range s.shards {
+		n += s.shards[i].load().Len()
+	}
+	return n
 }
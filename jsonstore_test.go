@@ -25,10 +25,10 @@ func TestOpen(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	if len(ks.data) != 1 {
-		t.Errorf("expected %d got %d", 1, len(ks.data))
+	if ks.Size() != 1 {
+		t.Errorf("expected %d got %d", 1, ks.Size())
 	}
-	if world, ok := ks.data["hello"]; !ok || string(*world) != `"world"` {
+	if world, err := ks.GetRawUnsafe("hello"); err != nil || string(world) != `"world"` {
 		t.Errorf("expected %s got %s", "world", world)
 	}
 }
@@ -252,12 +252,19 @@ type Human struct {
 }
 
 func BenchmarkGet(b *testing.B) {
+	for _, bc := range benchCodecs {
+		codec := bc.codec
+		b.Run(bc.name, func(b *testing.B) { benchmarkGet(b, codec) })
+	}
+}
+
+func benchmarkGet(b *testing.B, codec Codec) {
 	name, cleanup, err := setupJsonstore(1000)
 	if err != nil {
 		b.Fatal(err)
 	}
 	defer cleanup()
-	ks, err := Open(name)
+	ks, err := OpenFile(name, Options{Codec: codec})
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -298,12 +305,19 @@ func BenchmarkParaGet(b *testing.B) {
 }
 
 func BenchmarkSet(b *testing.B) {
+	for _, bc := range benchCodecs {
+		codec := bc.codec
+		b.Run(bc.name, func(b *testing.B) { benchmarkSet(b, codec) })
+	}
+}
+
+func benchmarkSet(b *testing.B, codec Codec) {
 	name, cleanup, err := setupJsonstore(1000)
 	if err != nil {
 		b.Fatal(err)
 	}
 	defer cleanup()
-	ks, err := Open(name)
+	ks, err := OpenFile(name, Options{Codec: codec})
 	if err != nil {
 		b.Fatal(err)
 	}
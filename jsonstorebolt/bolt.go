@@ -0,0 +1,181 @@
+// Package jsonstorebolt migrates the data between JSONStore and BoltDB.
+//
+// A JSONStore key is a Bolt key, and the raw JSON value is the Bolt value.
+// With Options.Separator, the nested buckets are mapped to the prefixes of the keys:
+// the key "1" in the bucket "users" is the JSONStore key "users/1" if Separator is "/".
+package jsonstorebolt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/shogo82148/jsonstore"
+)
+
+// DefaultBatchSize is the default number of keys written in a transaction.
+const DefaultBatchSize = 1000
+
+// Options is the options of import and export.
+type Options struct {
+	// Separator joins the names of nested buckets and the keys.
+	// If it is empty, nested buckets are skipped on import, and keys are not split on export.
+	Separator string
+
+	// BatchSize is the number of keys written in a Bolt transaction on export.
+	// Zero means DefaultBatchSize.
+	BatchSize int
+}
+
+func (opts *Options) separator() string {
+	if opts == nil {
+		return ""
+	}
+	return opts.Separator
+}
+
+func (opts *Options) batchSize() int {
+	if opts == nil || opts.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return opts.BatchSize
+}
+
+// ImportFile is like Import, but it opens the Bolt database in filename read-only.
+func ImportFile(ks *jsonstore.JSONStore, filename, bucket string, opts *Options) (int, error) {
+	db, err := bolt.Open(filename, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	return Import(ks, db, bucket, opts)
+}
+
+// Import copies the keys in bucket of db into ks, and returns the number of imported keys.
+// The values must be valid JSON.
+// The keys are read with a cursor in a read-only transaction, so large databases are not loaded into memory at once.
+func Import(ks *jsonstore.JSONStore, db *bolt.DB, bucket string, opts *Options) (int, error) {
+	n := 0
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return fmt.Errorf("jsonstorebolt: bucket %q not found", bucket)
+		}
+		return importBucket(ks, b, "", opts.separator(), &n)
+	})
+	return n, err
+}
+
+func importBucket(ks *jsonstore.JSONStore, b *bolt.Bucket, prefix, sep string, n *int) error {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		key := prefix + string(k)
+		if v == nil {
+			// a nested bucket
+			if sep == "" {
+				continue
+			}
+			if err := importBucket(ks, b.Bucket(k), key+sep, sep, n); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := ks.SetRaw(key, v); err != nil {
+			return fmt.Errorf("jsonstorebolt: key %q: %v", key, err)
+		}
+		*n++
+	}
+	return nil
+}
+
+// ExportFile is like Export, but it opens or creates the Bolt database in filename.
+func ExportFile(ks *jsonstore.JSONStore, filename, bucket string, opts *Options) (int, error) {
+	db, err := bolt.Open(filename, 0600, nil)
+	if err != nil {
+		return 0, err
+	}
+	n, err := Export(ks, db, bucket, opts)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// Export writes the keys of ks into bucket of db, and returns the number of exported keys.
+// The bucket is created if it does not exist.
+// Export writes a snapshot of ks in the order of the keys, in transactions of Options.BatchSize keys,
+// so the export of a large store is not atomic.
+// The encrypted fields are copied without decryption.
+func Export(ks *jsonstore.JSONStore, db *bolt.DB, bucket string, opts *Options) (int, error) {
+	type entry struct {
+		key   string
+		value json.RawMessage
+	}
+	view := ks.Snapshot()
+	defer view.Release()
+
+	sep := opts.separator()
+	size := opts.batchSize()
+	batch := make([]entry, 0, size)
+	n := 0
+	flush := func() error {
+		err := db.Update(func(tx *bolt.Tx) error {
+			root, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return err
+			}
+			for _, e := range batch {
+				b, name, err := nestedBucket(root, e.key, sep)
+				if err != nil {
+					return fmt.Errorf("jsonstorebolt: key %q: %v", e.key, err)
+				}
+				// bolt requires the value to be valid while the transaction is open,
+				// and the snapshot keeps it.
+				if err := b.Put(name, e.value); err != nil {
+					return fmt.Errorf("jsonstorebolt: key %q: %v", e.key, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		n += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	var err error
+	view.RangeSorted(func(key string, value json.RawMessage) bool {
+		batch = append(batch, entry{key, value})
+		if len(batch) == size {
+			err = flush()
+		}
+		return err == nil
+	})
+	if err == nil && len(batch) > 0 {
+		err = flush()
+	}
+	return n, err
+}
+
+// nestedBucket returns the bucket and the name for key, creating the nested buckets.
+func nestedBucket(b *bolt.Bucket, key, sep string) (*bolt.Bucket, []byte, error) {
+	if sep == "" {
+		return b, []byte(key), nil
+	}
+	parts := strings.Split(key, sep)
+	for _, name := range parts[:len(parts)-1] {
+		child, err := b.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return nil, nil, err
+		}
+		b = child
+	}
+	name := []byte(parts[len(parts)-1])
+	if len(name) == 0 {
+		return nil, nil, bolt.ErrKeyRequired
+	}
+	return b, name, nil
+}
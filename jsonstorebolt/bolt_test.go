@@ -0,0 +1,193 @@
+package jsonstorebolt
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/shogo82148/jsonstore"
+)
+
+type Human struct {
+	Name   string
+	Height float64
+}
+
+func setupDB(t *testing.T) (*bolt.DB, string, func()) {
+	dir, err := ioutil.TempDir("", "jsonstorebolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "bolt.db")
+	db, err := bolt.Open(filename, 0600, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, filename, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func storeData(ks *jsonstore.JSONStore) map[string]string {
+	data := map[string]string{}
+	ks.Range(func(key string, value json.RawMessage) bool {
+		data[key] = string(value)
+		return true
+	})
+	return data
+}
+
+func TestRoundTrip(t *testing.T) {
+	db, _, cleanup := setupDB(t)
+	defer cleanup()
+
+	ks := new(jsonstore.JSONStore)
+	for i := 0; i < 2500; i++ {
+		ks.Set("human:"+strconv.Itoa(i), Human{"Dante", float64(i)})
+	}
+	n, err := Export(ks, db, "MyBucket", &Options{BatchSize: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2500 {
+		t.Errorf("want 2500, got %d", n)
+	}
+
+	ks2 := new(jsonstore.JSONStore)
+	n, err = Import(ks2, db, "MyBucket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2500 {
+		t.Errorf("want 2500, got %d", n)
+	}
+	if !reflect.DeepEqual(storeData(ks), storeData(ks2)) {
+		t.Error("imported data differs")
+	}
+}
+
+func TestSensitiveFields(t *testing.T) {
+	db, _, cleanup := setupDB(t)
+	defer cleanup()
+
+	key, err := jsonstore.NewKey(bytes.Repeat([]byte{1}, jsonstore.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := jsonstore.SensitiveFields{Paths: []string{"/Name"}, Key: key}
+	ks := new(jsonstore.JSONStore)
+	ks.RegisterSensitiveFields(fields)
+	ks.Set("human:1", Human{"Dante", 5.4})
+	if _, err := Export(ks, db, "MyBucket", nil); err != nil {
+		t.Fatal(err)
+	}
+	db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte("MyBucket")).Get([]byte("human:1")); bytes.Contains(v, []byte("Dante")) {
+			t.Errorf("the field is exported in plaintext: %s", v)
+		}
+		return nil
+	})
+
+	ks2 := new(jsonstore.JSONStore)
+	ks2.RegisterSensitiveFields(fields)
+	if _, err := Import(ks2, db, "MyBucket", nil); err != nil {
+		t.Fatal(err)
+	}
+	var human Human
+	if err := ks2.Get("human:1", &human); err != nil || human.Name != "Dante" {
+		t.Errorf("want Dante, got %q, %v", human.Name, err)
+	}
+}
+
+func TestNestedBuckets(t *testing.T) {
+	db, _, cleanup := setupDB(t)
+	defer cleanup()
+
+	ks := new(jsonstore.JSONStore)
+	ks.Set("top", 1)
+	ks.Set("users/1", Human{"Dante", 5.4})
+	ks.Set("users/admins/2", Human{"Virgil", 5.8})
+	if _, err := Export(ks, db, "root", &Options{Separator: "/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("root")).Bucket([]byte("users")).Bucket([]byte("admins"))
+		if b == nil {
+			t.Fatal("nested bucket is not created")
+		}
+		if v := b.Get([]byte("2")); string(v) != `{"Name":"Virgil","Height":5.8}` {
+			t.Errorf("unexpected value: %s", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks2 := new(jsonstore.JSONStore)
+	if _, err := Import(ks2, db, "root", &Options{Separator: "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(storeData(ks), storeData(ks2)) {
+		t.Errorf("want %v, got %v", storeData(ks), storeData(ks2))
+	}
+
+	// without Separator, nested buckets are skipped
+	ks3 := new(jsonstore.JSONStore)
+	n, err := Import(ks3, db, "root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || ks3.Size() != 1 {
+		t.Errorf("want only the top key, got %v", storeData(ks3))
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	db, _, cleanup := setupDB(t)
+	defer cleanup()
+
+	if _, err := Import(new(jsonstore.JSONStore), db, "missing", nil); err == nil {
+		t.Error("want error for a missing bucket")
+	}
+
+	db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("MyBucket"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("broken"), []byte("not json"))
+	})
+	if _, err := Import(new(jsonstore.JSONStore), db, "MyBucket", nil); err == nil {
+		t.Error("want error for invalid JSON")
+	}
+}
+
+func TestFile(t *testing.T) {
+	db, filename, cleanup := setupDB(t)
+	defer cleanup()
+	db.Close()
+
+	ks := new(jsonstore.JSONStore)
+	ks.Set("hello", "world")
+	if _, err := ExportFile(ks, filename, "MyBucket", nil); err != nil {
+		t.Fatal(err)
+	}
+	ks2 := new(jsonstore.JSONStore)
+	if _, err := ImportFile(ks2, filename, "MyBucket", nil); err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if err := ks2.Get("hello", &s); err != nil || s != "world" {
+		t.Errorf("want world, got %q, %v", s, err)
+	}
+}
@@ -0,0 +1,192 @@
+package jsonstorehttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+// StatusError is returned when the server responds with an unexpected status.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("jsonstorehttp: %d %s: %s", err.StatusCode, http.StatusText(err.StatusCode), err.Message)
+}
+
+// Client is a client of Handler. It implements jsonstore.Store.
+// Delete, Keys, Size and Range of jsonstore.Store can't return errors,
+// so Remove, ListKeys, Count and Export return the errors instead.
+// A Client is safe for concurrent use by multiple goroutines.
+type Client struct {
+	// HTTPClient is used for sending requests. nil means http.DefaultClient.
+	HTTPClient *http.Client
+
+	baseURL string
+}
+
+// NewClient returns a new client of the handler served at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Get will return the value associated with a key.
+// It returns NoSuchKeyError if the key does not exist.
+func (c *Client) Get(key string, v interface{}) error {
+	body, err := c.do(http.MethodGet, keyPath(key), nil, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// Set saves a value at the given key.
+func (c *Client) Set(key string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(http.MethodPut, keyPath(key), b, key)
+	return err
+}
+
+// Delete removes a key from the store. It ignores the errors; use Remove to know them.
+func (c *Client) Delete(key string) {
+	c.Remove(key)
+}
+
+// Remove removes a key from the store.
+// Removing a missing key is not an error, like JSONStore.Delete.
+func (c *Client) Remove(key string) error {
+	_, err := c.do(http.MethodDelete, keyPath(key), nil, key)
+	if _, ok := err.(jsonstore.NoSuchKeyError); ok {
+		err = nil
+	}
+	return err
+}
+
+// Keys returns all the keys currently in the store. It returns nil on error; use ListKeys to know it.
+func (c *Client) Keys() []string {
+	keys, _ := c.ListKeys()
+	return keys
+}
+
+// ListKeys returns all the keys currently in the store in the sorted order.
+func (c *Client) ListKeys() ([]string, error) {
+	keys := []string{}
+	after := ""
+	for {
+		path := "/keys?limit=" + strconv.Itoa(MaxListLimit) + "&after=" + url.QueryEscape(after)
+		body, err := c.do(http.MethodGet, path, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		var resp ListResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		keys = append(keys, resp.Keys...)
+		if resp.Next == "" {
+			break
+		}
+		after = resp.Next
+	}
+	return keys, nil
+}
+
+// Size returns the count element in the store. It returns 0 on error; use Count to know it.
+func (c *Client) Size() int {
+	n, _ := c.Count()
+	return n
+}
+
+// Count returns the count element in the store.
+func (c *Client) Count() (int, error) {
+	body, err := c.do(http.MethodGet, "/size", nil, "")
+	if err != nil {
+		return 0, err
+	}
+	var resp SizeResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Size, nil
+}
+
+func keyPath(key string) string {
+	return "/keys/" + url.PathEscape(key)
+}
+
+// do sends a request, and returns the response body.
+// key is the key of the request, which is used for NoSuchKeyError.
+func (c *Client) do(method, path string, body []byte, key string) ([]byte, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return b, nil
+	}
+	if resp.StatusCode == http.StatusNotFound && key != "" {
+		return nil, jsonstore.NoSuchKeyError{Key: key}
+	}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(b, &errResp); err != nil || errResp.Error == "" {
+		errResp.Error = string(b)
+	}
+	return nil, &StatusError{StatusCode: resp.StatusCode, Message: errResp.Error}
+}
+
+// Range calls fn for each key and value until fn returns false.
+// It downloads the whole store once by Export, and it calls fn for no keys if the download fails.
+func (c *Client) Range(fn func(key string, value json.RawMessage) bool) {
+	data, _ := c.Export()
+	for key, value := range data {
+		if !fn(key, value) {
+			return
+		}
+	}
+}
+
+// Export downloads the whole store.
+func (c *Client) Export() (map[string]json.RawMessage, error) {
+	body, err := c.do(http.MethodGet, "/export", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,117 @@
+package jsonstorehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/shogo82148/jsonstore"
+	"github.com/shogo82148/jsonstore/jsonstoretest"
+)
+
+var _ jsonstore.Store = (*Client)(nil)
+
+func TestClient(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	server := httptest.NewServer(NewHandler(ks))
+	defer server.Close()
+	c := NewClient(server.URL + "/")
+
+	if err := c.Set("human:1", Human{"Dante", 5.4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("a/b", "slash"); err != nil {
+		t.Fatal(err)
+	}
+
+	var human Human
+	if err := c.Get("human:1", &human); err != nil {
+		t.Fatal(err)
+	}
+	if human.Name != "Dante" || human.Height != 5.4 {
+		t.Errorf("unexpected value: %v", human)
+	}
+	var s string
+	if err := ks.Get("a/b", &s); err != nil || s != "slash" {
+		t.Errorf("want slash, got %q, %v", s, err)
+	}
+
+	err := c.Get("human:2", &human)
+	if err != (jsonstore.NoSuchKeyError{Key: "human:2"}) {
+		t.Errorf("want NoSuchKeyError, got %v", err)
+	}
+
+	if c.Size() != 2 {
+		t.Errorf("want 2, got %d", c.Size())
+	}
+
+	c.Delete("a/b")
+	if err := c.Remove("missing"); err != nil {
+		t.Error(err)
+	}
+	if ks.Size() != 1 {
+		t.Errorf("want 1, got %d", ks.Size())
+	}
+}
+
+func TestClientKeys(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	for i := 0; i < MaxListLimit+10; i++ {
+		ks.Set(strconv.Itoa(i), i)
+	}
+	server := httptest.NewServer(NewHandler(ks))
+	defer server.Close()
+	c := NewClient(server.URL)
+
+	keys := c.Keys()
+	if len(keys) != MaxListLimit+10 {
+		t.Fatalf("want %d, got %d", MaxListLimit+10, len(keys))
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Error("keys must be sorted")
+	}
+}
+
+func TestClientError(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	ks.RegisterSchemaPrefix("human:", jsonstore.MustCompileSchema([]byte(`{"required": ["Name"]}`)))
+	server := httptest.NewServer(NewHandler(ks))
+	c := NewClient(server.URL)
+
+	err := c.Set("human:1", map[string]string{})
+	if serr, ok := err.(*StatusError); !ok || serr.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("want StatusError, got %v", err)
+	}
+
+	server.Close()
+	if n, err := c.Count(); n != 0 || err == nil {
+		t.Errorf("want an error, got %d, %v", n, err)
+	}
+	if keys, err := c.ListKeys(); keys != nil || err == nil {
+		t.Errorf("want an error, got %v, %v", keys, err)
+	}
+	if err := c.Remove("human:1"); err == nil {
+		t.Error("want an error, got nil")
+	}
+	if data, err := c.Export(); data != nil || err == nil {
+		t.Errorf("want an error, got %v, %v", data, err)
+	}
+	if c.Size() != 0 || c.Keys() != nil {
+		t.Error("want the zero values")
+	}
+}
+
+func TestClientConformance(t *testing.T) {
+	jsonstoretest.Run(t, func(t *testing.T, data map[string]json.RawMessage) jsonstore.Store {
+		ks := new(jsonstore.JSONStore)
+		for k, v := range data {
+			ks.SetRaw(k, v)
+		}
+		server := httptest.NewServer(NewHandler(ks))
+		t.Cleanup(server.Close)
+		return NewClient(server.URL)
+	})
+}
@@ -0,0 +1,390 @@
+// Package jsonstorehttp exposes a JSONStore over HTTP.
+//
+// The handler serves the following endpoints:
+//
+//	GET    /keys/{key}   returns the raw JSON value of key
+//	PUT    /keys/{key}   saves the request body at key
+//	PATCH  /keys/{key}   applies a JSON Merge Patch (RFC 7386) to the value of key
+//	DELETE /keys/{key}   removes key
+//	GET    /keys         lists the keys, filtered by the prefix parameter
+//	GET    /size         returns the number of keys
+//	GET    /export       streams the whole store as a JSON object, like jsonstore.Save without the checksum footer
+//
+// Keys may contain slashes if they are escaped as %2F.
+// The responses for a key have an ETag header made from the version of the key,
+// and PUT, PATCH and DELETE respect If-Match and If-None-Match: *.
+//
+// Client accesses the handler with the same methods as JSONStore,
+// so code can switch between an embedded store and a remote one.
+package jsonstorehttp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+const (
+	// DefaultMaxBodySize is the default limit of the request body size.
+	DefaultMaxBodySize = 1 << 20
+
+	// DefaultListLimit is the number of keys listed when the limit parameter is omitted.
+	DefaultListLimit = 100
+
+	// MaxListLimit is the maximum number of keys listed at a time.
+	MaxListLimit = 1000
+)
+
+// Handler is an http.Handler which serves a JSONStore.
+type Handler struct {
+	// MaxBodySize is the limit of the request body size.
+	// Zero means DefaultMaxBodySize.
+	MaxBodySize int64
+
+	store *jsonstore.JSONStore
+}
+
+// NewHandler returns a new Handler serving s.
+func NewHandler(s *jsonstore.JSONStore) *Handler {
+	return &Handler{store: s}
+}
+
+// ListResponse is the response of listing keys.
+type ListResponse struct {
+	// Keys is the sorted keys.
+	Keys []string `json:"keys"`
+
+	// Next is the cursor for the next page, which is passed as the after parameter.
+	// It is empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// SizeResponse is the response of counting keys.
+type SizeResponse struct {
+	Size int `json:"size"`
+}
+
+// ErrorResponse is the response of a failed request.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	switch {
+	case path == "/keys" || path == "/keys/":
+		h.serveList(w, r)
+	case strings.HasPrefix(path, "/keys/"):
+		key, err := url.PathUnescape(strings.TrimPrefix(path, "/keys/"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		h.serveKey(w, r, key)
+	case path == "/size":
+		h.serveSize(w, r)
+	case path == "/export":
+		h.serveExport(w, r)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *Handler) serveKey(w http.ResponseWriter, r *http.Request, key string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, key)
+	case http.MethodPut:
+		h.put(w, r, key)
+	case http.MethodPatch:
+		h.patch(w, r, key)
+	case http.MethodDelete:
+		h.delete(w, r, key)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, key string) {
+	value, version, err := h.store.GetRawVersion(key)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	etag := formatETag(version)
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == "*" || matchETag(match, version)) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	w.Write(value)
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, key string) {
+	version, ok := h.expectedVersion(w, r, key)
+	if !ok {
+		return
+	}
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+	newVersion, err := h.store.CompareAndSetRaw(key, body, version)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("ETag", formatETag(newVersion))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) patch(w http.ResponseWriter, r *http.Request, key string) {
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/merge-patch+json") {
+		w.Header().Set("Accept-Patch", "application/merge-patch+json")
+		writeError(w, http.StatusUnsupportedMediaType, errors.New("unsupported patch format"))
+		return
+	}
+	version, ok := h.expectedVersion(w, r, key)
+	if !ok {
+		return
+	}
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+	value, newVersion, err := h.store.MergePatch(key, body, version)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("ETag", formatETag(newVersion))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(value)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, key string) {
+	version, ok := h.expectedVersion(w, r, key)
+	if !ok {
+		return
+	}
+	if err := h.store.CompareAndDelete(key, version); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// expectedVersion returns the version required by the conditional headers.
+// If-Match: * requires that key exists, so it is resolved to the current version.
+func (h *Handler) expectedVersion(w http.ResponseWriter, r *http.Request, key string) (int64, bool) {
+	if r.Header.Get("If-None-Match") == "*" {
+		return 0, true
+	}
+	match := r.Header.Get("If-Match")
+	if match == "" {
+		return jsonstore.AnyVersion, true
+	}
+	if match == "*" {
+		_, version, err := h.store.GetRawVersion(key)
+		if err != nil {
+			writeError(w, http.StatusPreconditionFailed, jsonstore.ErrVersionMismatch)
+			return 0, false
+		}
+		return version, true
+	}
+	version, err := parseETag(match)
+	if err != nil {
+		writeError(w, http.StatusPreconditionFailed, jsonstore.ErrVersionMismatch)
+		return 0, false
+	}
+	return version, true
+}
+
+func (h *Handler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	limit := h.MaxBodySize
+	if limit == 0 {
+		limit = DefaultMaxBodySize
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+		} else {
+			writeError(w, http.StatusBadRequest, err)
+		}
+		return nil, false
+	}
+	return body, true
+}
+
+func (h *Handler) serveList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	after := query.Get("after")
+	limit := DefaultListLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid limit"))
+			return
+		}
+		limit = n
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	view := h.store.Snapshot()
+	var keys []string
+	view.Range(func(key string, value json.RawMessage) bool {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	view.Release()
+	sort.Strings(keys)
+
+	resp := ListResponse{Keys: keys}
+	if len(keys) > limit {
+		resp.Keys = keys[:limit]
+		resp.Next = keys[limit-1]
+	}
+	if resp.Keys == nil {
+		resp.Keys = []string{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) serveSize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, SizeResponse{Size: h.store.Size()})
+}
+
+func (h *Handler) serveExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	view := h.store.Snapshot()
+	defer view.Release()
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	// the status is already sent, so an error can only abort the response.
+	writeExport(w, view)
+}
+
+// writeExport writes the view as a JSON object of the keys and the values, like View.WriteTo.
+// The entries are encoded one by one, so the response is sent while it is encoded
+// instead of after the whole store is encoded in memory.
+func writeExport(w io.Writer, view *jsonstore.View) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('{')
+	first := true
+	var err error
+	// the keys are sorted like encoding/json sorts the keys of a map.
+	view.RangeSorted(func(key string, value json.RawMessage) bool {
+		if !first {
+			bw.WriteByte(',')
+		}
+		first = false
+		var k, v []byte
+		if k, err = json.Marshal(key); err != nil {
+			return false
+		}
+		if v, err = json.Marshal(value); err != nil {
+			return false
+		}
+		bw.Write(k)
+		bw.WriteByte(':')
+		_, err = bw.Write(v)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+func formatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseETag parses a strong entity tag made by formatETag.
+func parseETag(etag string) (int64, error) {
+	etag = strings.TrimSpace(etag)
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, errors.New("invalid etag")
+	}
+	return strconv.ParseInt(etag[1:len(etag)-1], 10, 64)
+}
+
+// matchETag reports whether the list of entity tags contains version.
+// Weak tags are compared weakly as RFC 7232 requires for If-None-Match.
+func matchETag(list string, version int64) bool {
+	for _, etag := range strings.Split(list, ",") {
+		etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+		if v, err := parseETag(etag); err == nil && v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch err.(type) {
+	case jsonstore.NoSuchKeyError:
+		writeError(w, http.StatusNotFound, err)
+		return
+	case *jsonstore.ValidationError:
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	switch err {
+	case jsonstore.ErrVersionMismatch:
+		writeError(w, http.StatusPreconditionFailed, err)
+	case jsonstore.ErrInvalidJSON:
+		writeError(w, http.StatusBadRequest, err)
+	case jsonstore.ErrReadOnly:
+		writeError(w, http.StatusForbidden, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,309 @@
+package jsonstorehttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+type Human struct {
+	Name   string
+	Height float64
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerKey(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	h := NewHandler(ks)
+
+	rec := do(t, h, "GET", "/keys/human:1", "", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("want %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	rec = do(t, h, "PUT", "/keys/human:1", `{"Name": "Dante", "Height": 5.4}`, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("want %d, got %d: %s", http.StatusNoContent, rec.Code, rec.Body.String())
+	}
+	etag := rec.Header().Get("ETag")
+
+	var human Human
+	if err := ks.Get("human:1", &human); err != nil {
+		t.Fatal(err)
+	}
+	if human.Name != "Dante" {
+		t.Errorf("want Dante, got %s", human.Name)
+	}
+
+	rec = do(t, h, "GET", "/keys/human:1", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, rec.Code)
+	}
+	if rec.Body.String() != `{"Name":"Dante","Height":5.4}` {
+		t.Errorf("unexpected body: %s", rec.Body.String())
+	}
+	if rec.Header().Get("ETag") != etag {
+		t.Errorf("want %s, got %s", etag, rec.Header().Get("ETag"))
+	}
+
+	rec = do(t, h, "GET", "/keys/human:1", "", map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("want %d, got %d", http.StatusNotModified, rec.Code)
+	}
+
+	rec = do(t, h, "PUT", "/keys/human:1", `{`, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("want %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = do(t, h, "DELETE", "/keys/human:1", "", nil)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("want %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	rec = do(t, h, "DELETE", "/keys/human:1", "", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("want %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	rec = do(t, h, "POST", "/keys/human:1", "", nil)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("want %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
+
+func TestHandlerEscapedKey(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	h := NewHandler(ks)
+	rec := do(t, h, "PUT", "/keys/a%2Fb%20c", `"hello"`, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("want %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	if _, err := ks.GetRaw("a/b c"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandlerConditional(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	h := NewHandler(ks)
+
+	// If-None-Match: * creates only
+	rec := do(t, h, "PUT", "/keys/hello", `"world"`, map[string]string{"If-None-Match": "*"})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("want %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	etag := rec.Header().Get("ETag")
+	rec = do(t, h, "PUT", "/keys/hello", `"again"`, map[string]string{"If-None-Match": "*"})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("want %d, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+
+	rec = do(t, h, "PUT", "/keys/hello", `"jsonstore"`, map[string]string{"If-Match": etag})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("want %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	newETag := rec.Header().Get("ETag")
+	if newETag == etag {
+		t.Error("ETag must change")
+	}
+
+	// stale ETag
+	rec = do(t, h, "PUT", "/keys/hello", `"stale"`, map[string]string{"If-Match": etag})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("want %d, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+	rec = do(t, h, "DELETE", "/keys/hello", "", map[string]string{"If-Match": etag})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("want %d, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+	rec = do(t, h, "PUT", "/keys/missing", `"stale"`, map[string]string{"If-Match": "*"})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("want %d, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+
+	rec = do(t, h, "DELETE", "/keys/hello", "", map[string]string{"If-Match": newETag})
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("want %d, got %d", http.StatusNoContent, rec.Code)
+	}
+}
+
+func TestHandlerPatch(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	ks.RegisterSchemaPrefix("human:", jsonstore.MustCompileSchema([]byte(`{"required": ["Name"]}`)))
+	ks.Set("human:1", Human{"Dante", 5.4})
+	h := NewHandler(ks)
+	mergePatch := map[string]string{"Content-Type": "application/merge-patch+json"}
+
+	rec := do(t, h, "PATCH", "/keys/human:1", `{"Height": 5.5}`, nil)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("want %d, got %d", http.StatusUnsupportedMediaType, rec.Code)
+	}
+
+	rec = do(t, h, "PATCH", "/keys/human:1", `{"Height": 5.5}`, mergePatch)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if rec.Body.String() != `{"Height":5.5,"Name":"Dante"}` {
+		t.Errorf("unexpected body: %s", rec.Body.String())
+	}
+	var human Human
+	ks.Get("human:1", &human)
+	if human.Height != 5.5 {
+		t.Errorf("want 5.5, got %f", human.Height)
+	}
+
+	rec = do(t, h, "PATCH", "/keys/human:1", `{"Name": null}`, mergePatch)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("want %d, got %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+
+	mergePatch["If-Match"] = `"0"`
+	rec = do(t, h, "PATCH", "/keys/human:1", `{"Height": 5.6}`, mergePatch)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("want %d, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+}
+
+func TestHandlerList(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	for i := 0; i < 25; i++ {
+		ks.Set("human:"+strconv.Itoa(100+i), i)
+		ks.Set("dog:"+strconv.Itoa(100+i), i)
+	}
+	h := NewHandler(ks)
+
+	var keys []string
+	after := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		rec := do(t, h, "GET", "/keys?prefix=human:&limit=10&after="+after, "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("want %d, got %d", http.StatusOK, rec.Code)
+		}
+		var resp ListResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, resp.Keys...)
+		if resp.Next == "" {
+			break
+		}
+		after = resp.Next
+	}
+	if len(keys) != 25 {
+		t.Fatalf("want 25 keys, got %d", len(keys))
+	}
+	for i, key := range keys {
+		if want := "human:" + strconv.Itoa(100+i); key != want {
+			t.Errorf("want %s, got %s", want, key)
+		}
+	}
+
+	rec := do(t, h, "GET", "/keys?limit=-1", "", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("want %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestHandlerExport(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	ks.Set("human:1", Human{"Dante", 5.4})
+	ks.Set("human:2", Human{"Virgil", 5.8})
+	server := httptest.NewServer(NewHandler(ks))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data map[string]Human
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || data["human:2"].Name != "Virgil" {
+		t.Errorf("unexpected export: %s", body)
+	}
+
+	// the export is the same as the file written by jsonstore.Save.
+	var buf bytes.Buffer
+	view := ks.Snapshot()
+	defer view.Release()
+	if _, err := view.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != buf.String() {
+		t.Errorf("want %s, got %s", buf.String(), body)
+	}
+}
+
+func TestHandlerMaxBodySize(t *testing.T) {
+	h := NewHandler(new(jsonstore.JSONStore))
+	h.MaxBodySize = 8
+	rec := do(t, h, "PUT", "/keys/hello", `"hello, world"`, nil)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("want %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+}
+
+func TestHandlerReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstorehttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ro.json.gz")
+	ks, err := jsonstore.OpenFile(filename, jsonstore.Options{Create: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("hello", "world")
+	if err := ks.Save(); err != nil {
+		t.Fatal(err)
+	}
+	ks.Close()
+
+	ks, err = jsonstore.OpenFile(filename, jsonstore.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ks.Close()
+	h := NewHandler(ks)
+	rec := do(t, h, "PUT", "/keys/hello", `"bye"`, nil)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("want %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	rec = do(t, h, "DELETE", "/keys/hello", "", nil)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("want %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	rec = do(t, h, "GET", "/keys/hello", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("want %d, got %d", http.StatusOK, rec.Code)
+	}
+}
@@ -0,0 +1,117 @@
+package jsonstoreredis
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+)
+
+var errProtocol = errors.New("jsonstoreredis: protocol error")
+
+// redisError is an error reply of Redis.
+type redisError string
+
+func (err redisError) Error() string {
+	return string(err)
+}
+
+// client is a minimal client of RESP2.
+type client struct {
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func newClient(conn io.ReadWriter) *client {
+	return &client{
+		r: bufio.NewReader(conn),
+		w: bufio.NewWriter(conn),
+	}
+}
+
+// do sends a command, and returns the reply.
+func (c *client) do(args ...string) (interface{}, error) {
+	c.send(args...)
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+// send writes a command into the buffer.
+func (c *client) send(args ...string) {
+	writeCommand(c.w, args...)
+}
+
+func (c *client) flush() error {
+	return c.w.Flush()
+}
+
+// reply reads a reply.
+// The reply is a string for simple strings, a []byte or nil for bulk strings,
+// an int64, a redisError or a []interface{}.
+func (c *client) reply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, errProtocol
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			if arr[i], err = c.reply(); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+	return nil, errProtocol
+}
+
+// writeCommand writes a command as an array of bulk strings.
+func writeCommand(w *bufio.Writer, args ...string) {
+	w.WriteByte('*')
+	w.WriteString(strconv.Itoa(len(args)))
+	w.WriteString("\r\n")
+	for _, arg := range args {
+		w.WriteByte('$')
+		w.WriteString(strconv.Itoa(len(arg)))
+		w.WriteString("\r\n")
+		w.WriteString(arg)
+		w.WriteString("\r\n")
+	}
+}
@@ -0,0 +1,46 @@
+package jsonstoreredis
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/shogo82148/jsonstore"
+	"github.com/shogo82148/jsonstore/internal/redisconv"
+)
+
+// ExportOptions is the options of Export.
+type ExportOptions struct {
+	// ExpireAt returns the expiration of key, if it is not nil.
+	// The expirations are written as PEXPIREAT commands.
+	ExpireAt func(key string) (time.Time, bool)
+}
+
+// Export writes the keys of ks as SET commands in the Redis protocol, and returns the number of keys.
+// The output can be loaded by redis-cli --pipe.
+// The keys are written from a snapshot in the sorted order.
+// The encrypted fields are set as their ciphertext strings.
+func Export(ks *jsonstore.JSONStore, w io.Writer, opts *ExportOptions) (int, error) {
+	view := ks.Snapshot()
+	defer view.Release()
+
+	bw := bufio.NewWriter(w)
+	n := 0
+	view.RangeSorted(func(key string, value json.RawMessage) bool {
+		writeCommand(bw, "SET", key, string(redisconv.FromJSON(value)))
+		if opts != nil && opts.ExpireAt != nil {
+			if at, ok := opts.ExpireAt(key); ok {
+				ms := at.UnixNano() / int64(time.Millisecond)
+				writeCommand(bw, "PEXPIREAT", key, strconv.FormatInt(ms, 10))
+			}
+		}
+		n++
+		return true
+	})
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
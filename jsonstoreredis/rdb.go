@@ -0,0 +1,453 @@
+package jsonstoreredis
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+// ErrInvalidRDB is returned when the RDB file is broken.
+var ErrInvalidRDB = errors.New("jsonstoreredis: invalid RDB file")
+
+// the opcodes and the value types of RDB
+const (
+	rdbOpSlotInfo     = 0xF4
+	rdbOpFunction2    = 0xF5
+	rdbOpModuleAux    = 0xF7
+	rdbOpIdle         = 0xF8
+	rdbOpFreq         = 0xF9
+	rdbOpAux          = 0xFA
+	rdbOpResizeDB     = 0xFB
+	rdbOpExpireTimeMS = 0xFC
+	rdbOpExpireTime   = 0xFD
+	rdbOpSelectDB     = 0xFE
+	rdbOpEOF          = 0xFF
+
+	rdbTypeString         = 0
+	rdbTypeList           = 1
+	rdbTypeSet            = 2
+	rdbTypeZSet           = 3
+	rdbTypeHash           = 4
+	rdbTypeZSet2          = 5
+	rdbTypeHashZipmap     = 9
+	rdbTypeListZiplist    = 10
+	rdbTypeSetIntset      = 11
+	rdbTypeZSetZiplist    = 12
+	rdbTypeHashZiplist    = 13
+	rdbTypeListQuicklist  = 14
+	rdbTypeHashListpack   = 16
+	rdbTypeZSetListpack   = 17
+	rdbTypeListQuicklist2 = 18
+	rdbTypeSetListpack    = 20
+)
+
+const (
+	// rdbMaxVersion is the latest RDB version which ImportRDB supports.
+	rdbMaxVersion = 12
+
+	// rdbMaxStringLen is the maximum length of strings, the same as Redis.
+	rdbMaxStringLen uint64 = 512 << 20
+)
+
+// ImportRDB reads an RDB file of Redis, and copies the string keys into ks.
+// It returns the number of imported keys.
+// The keys of all databases are imported, and the expired keys and the keys of other types are skipped.
+// The file is read as a stream, so it is not loaded into memory at once.
+// Streams and module types are not supported.
+func ImportRDB(ks *jsonstore.JSONStore, r io.Reader, opts *ImportOptions) (int, error) {
+	p := &rdbParser{r: bufio.NewReader(r)}
+	return p.parse(ks, opts)
+}
+
+type rdbParser struct {
+	r *bufio.Reader
+}
+
+func (p *rdbParser) parse(ks *jsonstore.JSONStore, opts *ImportOptions) (int, error) {
+	var header [9]byte
+	if _, err := io.ReadFull(p.r, header[:]); err != nil {
+		return 0, ErrInvalidRDB
+	}
+	if string(header[:5]) != "REDIS" {
+		return 0, ErrInvalidRDB
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil || version < 1 || version > rdbMaxVersion {
+		return 0, fmt.Errorf("jsonstoreredis: unsupported RDB version %q", header[5:])
+	}
+
+	n := 0
+	now := time.Now()
+	var expireAt time.Time
+	for {
+		typ, err := p.r.ReadByte()
+		if err != nil {
+			return n, unexpectedEOF(err)
+		}
+		switch typ {
+		case rdbOpEOF:
+			// the checksum follows since version 5, which is not verified.
+			return n, nil
+		case rdbOpSelectDB:
+			if _, err := p.readLength(); err != nil {
+				return n, err
+			}
+		case rdbOpResizeDB:
+			if err := p.skipLengths(2); err != nil {
+				return n, err
+			}
+		case rdbOpSlotInfo:
+			if err := p.skipLengths(3); err != nil {
+				return n, err
+			}
+		case rdbOpAux:
+			if err := p.skipStrings(2); err != nil {
+				return n, err
+			}
+		case rdbOpFunction2:
+			if err := p.skipStrings(1); err != nil {
+				return n, err
+			}
+		case rdbOpIdle:
+			if _, err := p.readLength(); err != nil {
+				return n, err
+			}
+		case rdbOpFreq:
+			if _, err := p.r.ReadByte(); err != nil {
+				return n, unexpectedEOF(err)
+			}
+		case rdbOpExpireTime:
+			var b [4]byte
+			if _, err := io.ReadFull(p.r, b[:]); err != nil {
+				return n, unexpectedEOF(err)
+			}
+			expireAt = time.Unix(int64(binary.LittleEndian.Uint32(b[:])), 0)
+		case rdbOpExpireTimeMS:
+			var b [8]byte
+			if _, err := io.ReadFull(p.r, b[:]); err != nil {
+				return n, unexpectedEOF(err)
+			}
+			ms := int64(binary.LittleEndian.Uint64(b[:]))
+			expireAt = time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+		case rdbOpModuleAux:
+			return n, errors.New("jsonstoreredis: RDB with modules is not supported")
+		default:
+			key, err := p.readString()
+			if err != nil {
+				return n, err
+			}
+			if typ != rdbTypeString {
+				if err := p.skipValue(typ); err != nil {
+					return n, err
+				}
+				expireAt = time.Time{}
+				continue
+			}
+			value, err := p.readString()
+			if err != nil {
+				return n, err
+			}
+			if (expireAt.IsZero() || expireAt.After(now)) && opts.match(string(key)) {
+				if err := ks.SetRaw(string(key), toJSON(value)); err != nil {
+					return n, fmt.Errorf("jsonstoreredis: key %q: %v", key, err)
+				}
+				n++
+				if !expireAt.IsZero() {
+					opts.onExpire(string(key), expireAt)
+				}
+			}
+			expireAt = time.Time{}
+		}
+	}
+}
+
+// skipValue skips a value which is not a string.
+func (p *rdbParser) skipValue(typ byte) error {
+	switch typ {
+	case rdbTypeList, rdbTypeSet, rdbTypeListQuicklist:
+		l, err := p.readLength()
+		if err != nil {
+			return err
+		}
+		return p.skipStrings(l)
+	case rdbTypeHash:
+		l, err := p.readLength()
+		if err != nil {
+			return err
+		}
+		return p.skipStrings(2 * l)
+	case rdbTypeZSet:
+		l, err := p.readLength()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < l; i++ {
+			if err := p.skipStrings(1); err != nil {
+				return err
+			}
+			// the score is a string with a 1-byte length, or a special value.
+			b, err := p.r.ReadByte()
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			if b < 253 {
+				if _, err := p.r.Discard(int(b)); err != nil {
+					return unexpectedEOF(err)
+				}
+			}
+		}
+		return nil
+	case rdbTypeZSet2:
+		l, err := p.readLength()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < l; i++ {
+			if err := p.skipStrings(1); err != nil {
+				return err
+			}
+			// binary double
+			if _, err := p.r.Discard(8); err != nil {
+				return unexpectedEOF(err)
+			}
+		}
+		return nil
+	case rdbTypeListQuicklist2:
+		l, err := p.readLength()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < l; i++ {
+			// the container type and the node
+			if _, err := p.readLength(); err != nil {
+				return err
+			}
+			if err := p.skipStrings(1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case rdbTypeHashZipmap, rdbTypeListZiplist, rdbTypeSetIntset, rdbTypeZSetZiplist,
+		rdbTypeHashZiplist, rdbTypeHashListpack, rdbTypeZSetListpack, rdbTypeSetListpack:
+		// encoded in a string
+		return p.skipStrings(1)
+	}
+	return fmt.Errorf("jsonstoreredis: unsupported RDB value type %d", typ)
+}
+
+// readLength reads a length.
+func (p *rdbParser) readLength() (uint64, error) {
+	l, encoded, err := p.readLengthOrEncoding()
+	if err != nil {
+		return 0, err
+	}
+	if encoded {
+		return 0, ErrInvalidRDB
+	}
+	return l, nil
+}
+
+// readLengthOrEncoding reads a length, or the type of a specially encoded string if encoded is true.
+func (p *rdbParser) readLengthOrEncoding() (l uint64, encoded bool, err error) {
+	b, err := p.r.ReadByte()
+	if err != nil {
+		return 0, false, unexpectedEOF(err)
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		next, err := p.r.ReadByte()
+		if err != nil {
+			return 0, false, unexpectedEOF(err)
+		}
+		return uint64(b&0x3f)<<8 | uint64(next), false, nil
+	case 2:
+		switch b {
+		case 0x80:
+			var buf [4]byte
+			if _, err := io.ReadFull(p.r, buf[:]); err != nil {
+				return 0, false, unexpectedEOF(err)
+			}
+			return uint64(binary.BigEndian.Uint32(buf[:])), false, nil
+		case 0x81:
+			var buf [8]byte
+			if _, err := io.ReadFull(p.r, buf[:]); err != nil {
+				return 0, false, unexpectedEOF(err)
+			}
+			return binary.BigEndian.Uint64(buf[:]), false, nil
+		}
+		return 0, false, ErrInvalidRDB
+	}
+	return uint64(b & 0x3f), true, nil
+}
+
+// readString reads a string, which may be an integer or compressed by LZF.
+func (p *rdbParser) readString() ([]byte, error) {
+	l, encoded, err := p.readLengthOrEncoding()
+	if err != nil {
+		return nil, err
+	}
+	if !encoded {
+		return p.readBytes(l)
+	}
+	switch l {
+	case 0:
+		b, err := p.r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return strconv.AppendInt(nil, int64(int8(b)), 10), nil
+	case 1:
+		var buf [2]byte
+		if _, err := io.ReadFull(p.r, buf[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return strconv.AppendInt(nil, int64(int16(binary.LittleEndian.Uint16(buf[:]))), 10), nil
+	case 2:
+		var buf [4]byte
+		if _, err := io.ReadFull(p.r, buf[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return strconv.AppendInt(nil, int64(int32(binary.LittleEndian.Uint32(buf[:]))), 10), nil
+	case 3:
+		clen, err := p.readLength()
+		if err != nil {
+			return nil, err
+		}
+		ulen, err := p.readLength()
+		if err != nil {
+			return nil, err
+		}
+		if ulen > rdbMaxStringLen {
+			return nil, ErrInvalidRDB
+		}
+		compressed, err := p.readBytes(clen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, int(ulen))
+	}
+	return nil, ErrInvalidRDB
+}
+
+func (p *rdbParser) readBytes(l uint64) ([]byte, error) {
+	if l > rdbMaxStringLen {
+		return nil, ErrInvalidRDB
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return buf, nil
+}
+
+func (p *rdbParser) skipStrings(n uint64) error {
+	for i := uint64(0); i < n; i++ {
+		l, encoded, err := p.readLengthOrEncoding()
+		if err != nil {
+			return err
+		}
+		if !encoded {
+			if l > math.MaxInt32 {
+				return ErrInvalidRDB
+			}
+			if _, err := p.r.Discard(int(l)); err != nil {
+				return unexpectedEOF(err)
+			}
+			continue
+		}
+		switch l {
+		case 0, 1, 2:
+			if _, err := p.r.Discard(1 << l); err != nil {
+				return unexpectedEOF(err)
+			}
+		case 3:
+			clen, err := p.readLength()
+			if err != nil {
+				return err
+			}
+			if _, err := p.readLength(); err != nil {
+				return err
+			}
+			if clen > math.MaxInt32 {
+				return ErrInvalidRDB
+			}
+			if _, err := p.r.Discard(int(clen)); err != nil {
+				return unexpectedEOF(err)
+			}
+		default:
+			return ErrInvalidRDB
+		}
+	}
+	return nil
+}
+
+func (p *rdbParser) skipLengths(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := p.readLength(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// lzfDecompress decompresses the data compressed by LZF, which Redis uses for long strings.
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			// literal run
+			l := ctrl + 1
+			if i+l > len(in) || len(out)+l > size {
+				return nil, ErrInvalidRDB
+			}
+			out = append(out, in[i:i+l]...)
+			i += l
+			continue
+		}
+
+		// back reference
+		l := ctrl >> 5
+		if l == 7 {
+			if i >= len(in) {
+				return nil, ErrInvalidRDB
+			}
+			l += int(in[i])
+			i++
+		}
+		l += 2
+		if i >= len(in) {
+			return nil, ErrInvalidRDB
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 || len(out)+l > size {
+			return nil, ErrInvalidRDB
+		}
+		// the reference may overlap the output, so copy byte by byte.
+		for j := 0; j < l; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != size {
+		return nil, ErrInvalidRDB
+	}
+	return out, nil
+}
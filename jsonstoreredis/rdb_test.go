@@ -0,0 +1,199 @@
+package jsonstoreredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+// rdbWriter builds RDB files for testing.
+type rdbWriter struct {
+	bytes.Buffer
+}
+
+func (w *rdbWriter) length(l int) {
+	switch {
+	case l < 1<<6:
+		w.WriteByte(byte(l))
+	case l < 1<<14:
+		w.WriteByte(byte(l>>8) | 0x40)
+		w.WriteByte(byte(l))
+	default:
+		w.WriteByte(0x80)
+		binary.Write(w, binary.BigEndian, uint32(l))
+	}
+}
+
+func (w *rdbWriter) str(s string) {
+	w.length(len(s))
+	w.WriteString(s)
+}
+
+func (w *rdbWriter) stringKey(key, value string) {
+	w.WriteByte(rdbTypeString)
+	w.str(key)
+	w.str(value)
+}
+
+func (w *rdbWriter) expireMS(at time.Time) {
+	w.WriteByte(rdbOpExpireTimeMS)
+	binary.Write(w, binary.LittleEndian, uint64(at.UnixNano()/int64(time.Millisecond)))
+}
+
+func buildRDB() []byte {
+	var w rdbWriter
+	w.WriteString("REDIS0009")
+	w.WriteByte(rdbOpAux)
+	w.str("redis-ver")
+	w.str("5.0.7")
+	w.WriteByte(rdbOpSelectDB)
+	w.length(0)
+	w.WriteByte(rdbOpResizeDB)
+	w.length(10)
+	w.length(2)
+
+	w.stringKey("human:1", `{"Name":"Dante","Height":5.4}`)
+	w.stringKey("greeting", "hello")
+	w.stringKey("long", strings.Repeat("x", 100))
+
+	// integer encoded strings
+	w.WriteByte(rdbTypeString)
+	w.str("int8")
+	w.Write([]byte{0xC0, 0xFE})
+	w.WriteByte(rdbTypeString)
+	w.str("int16")
+	w.Write([]byte{0xC1, 0x39, 0x30})
+	w.WriteByte(rdbTypeString)
+	w.str("int32")
+	w.Write([]byte{0xC2, 0x87, 0xD6, 0x12, 0x00})
+
+	// LZF compressed "aaaaaaaaaa": a literal "a" and a back reference of 9 bytes
+	w.WriteByte(rdbTypeString)
+	w.str("lzf")
+	w.WriteByte(0xC3)
+	w.length(5)
+	w.length(10)
+	w.Write([]byte{0x00, 'a', 0xE0, 0x00, 0x00})
+
+	// expiration
+	w.expireMS(time.Now().Add(-time.Hour))
+	w.stringKey("expired", "bye")
+	w.WriteByte(rdbOpExpireTime)
+	binary.Write(&w, binary.LittleEndian, uint32(time.Now().Add(time.Hour).Unix()))
+	w.stringKey("session", "abc")
+
+	// other types are skipped
+	w.WriteByte(rdbTypeList)
+	w.str("list")
+	w.length(2)
+	w.str("a")
+	w.str("b")
+	w.WriteByte(rdbTypeZSet)
+	w.str("zset")
+	w.length(2)
+	w.str("a")
+	w.str("1.5")
+	w.str("b")
+	w.WriteByte(254) // +inf
+	w.WriteByte(rdbTypeHash)
+	w.str("hash")
+	w.length(1)
+	w.str("field")
+	w.str("value")
+	w.WriteByte(rdbTypeHashZiplist)
+	w.str("ziplist")
+	w.str("\x00\x01\x02")
+
+	// another database
+	w.WriteByte(rdbOpSelectDB)
+	w.length(1)
+	w.stringKey("db1", "1")
+
+	w.WriteByte(rdbOpEOF)
+	w.Write(make([]byte, 8))
+	return w.Bytes()
+}
+
+func TestImportRDB(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	var expires []string
+	n, err := ImportRDB(ks, bytes.NewReader(buildRDB()), &ImportOptions{
+		OnExpire: func(key string, at time.Time) {
+			expires = append(expires, key)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"human:1":  `{"Name":"Dante","Height":5.4}`,
+		"greeting": `"hello"`,
+		"long":     `"` + strings.Repeat("x", 100) + `"`,
+		"int8":     `-2`,
+		"int16":    `12345`,
+		"int32":    `1234567`,
+		"lzf":      `"aaaaaaaaaa"`,
+		"session":  `"abc"`,
+		"db1":      `1`,
+	}
+	if n != len(want) || ks.Size() != len(want) {
+		t.Errorf("want %d keys, got %d, %v", len(want), n, ks.Keys())
+	}
+	for key, value := range want {
+		got, err := ks.GetRaw(key)
+		if err != nil {
+			t.Errorf("%s: %v", key, err)
+			continue
+		}
+		if string(got) != value {
+			t.Errorf("%s: want %s, got %s", key, value, got)
+		}
+	}
+	if len(expires) != 1 || expires[0] != "session" {
+		t.Errorf("unexpected expirations: %v", expires)
+	}
+}
+
+func TestImportRDBMatch(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	n, err := ImportRDB(ks, bytes.NewReader(buildRDB()), &ImportOptions{Match: "int*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("want 3, got %d", n)
+	}
+}
+
+func TestImportRDBBroken(t *testing.T) {
+	rdb := buildRDB()
+	tests := [][]byte{
+		[]byte("NOTREDIS0"),
+		[]byte("REDIS0099"),
+		rdb[:len(rdb)-20],
+	}
+	for _, data := range tests {
+		if _, err := ImportRDB(new(jsonstore.JSONStore), bytes.NewReader(data), nil); err == nil {
+			t.Errorf("want error for %q", data)
+		}
+	}
+}
+
+func TestLZFDecompress(t *testing.T) {
+	// "abcabcabc": a literal "abc" and a back reference of 6 bytes at distance 3
+	got, err := lzfDecompress([]byte{0x02, 'a', 'b', 'c', 0x80, 0x02}, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "abcabcabc" {
+		t.Errorf("want abcabcabc, got %s", got)
+	}
+	if _, err := lzfDecompress([]byte{0x80, 0x02}, 6); err == nil {
+		t.Error("want error for a reference before the beginning")
+	}
+}
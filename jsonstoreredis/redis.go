@@ -0,0 +1,144 @@
+// Package jsonstoreredis migrates the data between Redis and JSONStore.
+//
+// Import copies the string keys of a running Redis server with SCAN, ImportRDB reads
+// the string keys of an RDB file, and Export writes a store as Redis commands,
+// which can be loaded by redis-cli --pipe.
+//
+// A string which is valid JSON is imported as the JSON value, and other strings are imported as JSON strings,
+// because the data moved off Redis is often JSON. Export writes JSON strings as the strings, and other values as JSON text.
+// So a string which looks like JSON, such as "123", does not round-trip as a string.
+//
+// JSONStore has no expiration, so the TTLs of the imported keys are passed to ImportOptions.OnExpire,
+// and the exported expirations are taken from ExportOptions.ExpireAt.
+package jsonstoreredis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/shogo82148/jsonstore"
+	"github.com/shogo82148/jsonstore/internal/redisconv"
+)
+
+// DefaultScanCount is the default COUNT hint of SCAN.
+const DefaultScanCount = 100
+
+// ImportOptions is the options of Import and ImportRDB.
+type ImportOptions struct {
+	// Match is a glob-style pattern of the keys to import. Empty means all keys.
+	Match string
+
+	// Count is the COUNT hint of SCAN. Zero means DefaultScanCount.
+	Count int
+
+	// OnExpire is called for the imported keys which have expirations, if it is not nil.
+	OnExpire func(key string, at time.Time)
+}
+
+func (opts *ImportOptions) match(key string) bool {
+	return opts == nil || opts.Match == "" || redisconv.MatchPattern(opts.Match, key)
+}
+
+func (opts *ImportOptions) onExpire(key string, at time.Time) {
+	if opts != nil && opts.OnExpire != nil {
+		opts.OnExpire(key, at)
+	}
+}
+
+// toJSON converts an imported Redis string into a JSON value.
+func toJSON(b []byte) json.RawMessage {
+	if json.Valid(b) {
+		return b
+	}
+	s, _ := json.Marshal(string(b))
+	return s
+}
+
+// ImportAddr is like Import, but it connects to the Redis server at addr.
+func ImportAddr(ks *jsonstore.JSONStore, network, addr string, opts *ImportOptions) (int, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return Import(ks, conn, opts)
+}
+
+// Import copies the string keys of the Redis server connected by conn into ks,
+// and returns the number of imported keys.
+// The keys are iterated by SCAN, so the server is not blocked,
+// and the keys of other types are skipped.
+func Import(ks *jsonstore.JSONStore, conn io.ReadWriter, opts *ImportOptions) (int, error) {
+	c := newClient(conn)
+	count := DefaultScanCount
+	if opts != nil && opts.Count > 0 {
+		count = opts.Count
+	}
+
+	// SCAN may return a key more than once.
+	seen := map[string]struct{}{}
+	cursor := "0"
+	for {
+		args := []string{"SCAN", cursor}
+		if opts != nil && opts.Match != "" {
+			args = append(args, "MATCH", opts.Match)
+		}
+		args = append(args, "COUNT", strconv.Itoa(count))
+		reply, err := c.do(args...)
+		if err != nil {
+			return len(seen), err
+		}
+		arr, ok := reply.([]interface{})
+		if !ok || len(arr) != 2 {
+			return len(seen), fmt.Errorf("jsonstoreredis: unexpected reply of SCAN: %v", reply)
+		}
+		next, ok1 := arr[0].([]byte)
+		keys, ok2 := arr[1].([]interface{})
+		if !ok1 || !ok2 {
+			return len(seen), fmt.Errorf("jsonstoreredis: unexpected reply of SCAN: %v", reply)
+		}
+
+		// pipeline GET and PTTL of the keys
+		for _, k := range keys {
+			key, _ := k.([]byte)
+			c.send("GET", string(key))
+			c.send("PTTL", string(key))
+		}
+		if err := c.flush(); err != nil {
+			return len(seen), err
+		}
+		now := time.Now()
+		for _, k := range keys {
+			key, _ := k.([]byte)
+			value, err := c.reply()
+			if err != nil {
+				return len(seen), err
+			}
+			ttl, err := c.reply()
+			if err != nil {
+				return len(seen), err
+			}
+			v, ok := value.([]byte)
+			if !ok {
+				// the key has been removed, or it is not a string.
+				continue
+			}
+			if err := ks.SetRaw(string(key), toJSON(v)); err != nil {
+				return len(seen), fmt.Errorf("jsonstoreredis: key %q: %v", key, err)
+			}
+			seen[string(key)] = struct{}{}
+			if ms, ok := ttl.(int64); ok && ms > 0 {
+				opts.onExpire(string(key), now.Add(time.Duration(ms)*time.Millisecond))
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" {
+			return len(seen), nil
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package jsonstoreredis
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shogo82148/jsonstore"
+	"github.com/shogo82148/jsonstore/jsonstoreresp"
+)
+
+// setupServer starts a jsonstoreresp server, which stands in for Redis.
+func setupServer(t *testing.T) (*jsonstore.JSONStore, string) {
+	ks := new(jsonstore.JSONStore)
+	srv := jsonstoreresp.NewServer(ks)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return ks, l.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return newClient(conn)
+}
+
+func TestImport(t *testing.T) {
+	_, addr := setupServer(t)
+	c := dial(t, addr)
+	for i := 0; i < 250; i++ {
+		c.send("SET", "human:"+strconv.Itoa(i), `{"Name":"Dante"}`)
+	}
+	c.send("SET", "greeting", "hello")
+	c.send("SET", "session", "abc", "EX", "100")
+	c.flush()
+	for i := 0; i < 252; i++ {
+		if _, err := c.reply(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ks := new(jsonstore.JSONStore)
+	expires := map[string]time.Time{}
+	n, err := ImportAddr(ks, "tcp", addr, &ImportOptions{
+		Count: 30,
+		OnExpire: func(key string, at time.Time) {
+			expires[key] = at
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 252 || ks.Size() != 252 {
+		t.Errorf("want 252, got %d, %d", n, ks.Size())
+	}
+	var human struct{ Name string }
+	if err := ks.Get("human:42", &human); err != nil || human.Name != "Dante" {
+		t.Errorf("want Dante, got %v, %v", human, err)
+	}
+	var s string
+	if err := ks.Get("greeting", &s); err != nil || s != "hello" {
+		t.Errorf("want hello, got %q, %v", s, err)
+	}
+	if at, ok := expires["session"]; !ok || time.Until(at) < 99*time.Second {
+		t.Errorf("unexpected expiration: %v", expires)
+	}
+	if len(expires) != 1 {
+		t.Errorf("want 1 expiration, got %d", len(expires))
+	}
+
+	ks = new(jsonstore.JSONStore)
+	n, err = ImportAddr(ks, "tcp", addr, &ImportOptions{Match: "human:1?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Errorf("want 10, got %d", n)
+	}
+}
+
+func TestExport(t *testing.T) {
+	ks := new(jsonstore.JSONStore)
+	ks.Set("human:1", map[string]string{"Name": "Dante"})
+	ks.Set("greeting", "hello")
+	ks.Set("session", "abc")
+	at := time.Now().Add(time.Minute)
+
+	var buf bytes.Buffer
+	n, err := Export(ks, &buf, &ExportOptions{
+		ExpireAt: func(key string) (time.Time, bool) {
+			return at, key == "session"
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("want 3, got %d", n)
+	}
+	want := "*3\r\n$3\r\nSET\r\n$8\r\ngreeting\r\n$5\r\nhello\r\n"
+	if !bytes.HasPrefix(buf.Bytes(), []byte(want)) {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	// replay the commands
+	dst, addr := setupServer(t)
+	c := dial(t, addr)
+	c.w.Write(buf.Bytes())
+	c.flush()
+	for i := 0; i < 4; i++ {
+		reply, err := c.reply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rerr, ok := reply.(redisError); ok {
+			t.Fatal(rerr)
+		}
+	}
+	if dst.Size() != 3 {
+		t.Errorf("want 3, got %d", dst.Size())
+	}
+	// Redis has only strings, so the object is replayed as its JSON text.
+	got, _ := c.do("GET", "human:1")
+	if b, _ := got.([]byte); string(b) != `{"Name":"Dante"}` {
+		t.Errorf("unexpected value: %q", got)
+	}
+	dst.Delete("human:1")
+	ks.Delete("human:1")
+	if diffs := jsonstore.Diff(ks, dst); len(diffs) != 0 {
+		t.Errorf("unexpected differences: %v", diffs)
+	}
+	reply, _ := c.do("PTTL", "session")
+	if ms, ok := reply.(int64); !ok || ms <= 0 {
+		t.Errorf("want the expiration, got %v", reply)
+	}
+}
+
+func TestExportSensitiveFields(t *testing.T) {
+	key, err := jsonstore.NewKey(bytes.Repeat([]byte{1}, jsonstore.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := new(jsonstore.JSONStore)
+	ks.RegisterSensitiveFields(jsonstore.SensitiveFields{Paths: []string{"/password"}, Key: key})
+	ks.Set("account:1", map[string]string{"name": "dante", "password": "hunter2"})
+
+	var buf bytes.Buffer
+	if _, err := Export(ks, &buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("hunter2")) {
+		t.Errorf("the field is exported in plaintext: %q", buf.String())
+	}
+}
@@ -0,0 +1,455 @@
+package jsonstoreresp
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shogo82148/jsonstore"
+	"github.com/shogo82148/jsonstore/internal/redisconv"
+)
+
+type command struct {
+	// minArgs and maxArgs are the number of arguments including the command name.
+	// maxArgs -1 means no limit.
+	minArgs, maxArgs int
+
+	// fn executes the command, and reports whether the connection should be closed.
+	fn func(srv *Server, w *writer, args [][]byte) bool
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get":       {2, 2, cmdGet},
+		"set":       {3, -1, cmdSet},
+		"del":       {2, -1, cmdDel},
+		"exists":    {2, -1, cmdExists},
+		"keys":      {2, 2, cmdKeys},
+		"scan":      {2, -1, cmdScan},
+		"expire":    {3, 3, cmdExpire},
+		"pexpireat": {3, 3, cmdPExpireAt},
+		"ttl":       {2, 2, cmdTTL},
+		"pttl":      {2, 2, cmdPTTL},
+		"incr":      {2, 2, cmdIncr},
+		"dbsize":    {1, 1, cmdDBSize},
+		"ping":      {1, 2, cmdPing},
+		"echo":      {2, 2, cmdEcho},
+		"select":    {2, 2, cmdSelect},
+		"quit":      {1, 1, cmdQuit},
+		"command":   {1, -1, cmdCommand},
+	}
+}
+
+const (
+	errSyntax     = "ERR syntax error"
+	errNotInteger = "ERR value is not an integer or out of range"
+)
+
+// lookup returns the value and the version of key, removing the key if it has expired.
+func (srv *Server) lookup(key string) (json.RawMessage, int64, bool) {
+	value, version, err := srv.store.GetRawVersion(key)
+	if err != nil {
+		return nil, 0, false
+	}
+	srv.mu.Lock()
+	e := srv.expires[key]
+	srv.mu.Unlock()
+	if e != nil && e.version == version && !time.Now().Before(e.at) {
+		srv.expire(key, e)
+		return nil, 0, false
+	}
+	return value, version, true
+}
+
+// setExpiry makes key expire after d while it has the version.
+func (srv *Server) setExpiry(key string, version int64, d time.Duration) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if old := srv.expires[key]; old != nil {
+		old.timer.Stop()
+	}
+	e := &expiry{version: version, at: time.Now().Add(d)}
+	e.timer = time.AfterFunc(d, func() { srv.expire(key, e) })
+	srv.expires[key] = e
+}
+
+// moveExpiry moves the expiration of key from the old version to the new one.
+func (srv *Server) moveExpiry(key string, oldVersion, newVersion int64) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	e := srv.expires[key]
+	if e == nil || e.version != oldVersion {
+		return
+	}
+	e.timer.Stop()
+	moved := &expiry{version: newVersion, at: e.at}
+	moved.timer = time.AfterFunc(time.Until(e.at), func() { srv.expire(key, moved) })
+	srv.expires[key] = moved
+}
+
+func (srv *Server) clearExpiry(key string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if e := srv.expires[key]; e != nil {
+		e.timer.Stop()
+		delete(srv.expires, key)
+	}
+}
+
+// expire removes key if it still has the version of e.
+func (srv *Server) expire(key string, e *expiry) {
+	srv.store.CompareAndDelete(key, e.version)
+	srv.mu.Lock()
+	if srv.expires[key] == e {
+		delete(srv.expires, key)
+	}
+	srv.mu.Unlock()
+}
+
+func cmdGet(srv *Server, w *writer, args [][]byte) bool {
+	value, _, ok := srv.lookup(string(args[0]))
+	if !ok {
+		w.writeNil()
+		return false
+	}
+	w.writeBulk(redisconv.FromJSON(value))
+	return false
+}
+
+func cmdSet(srv *Server, w *writer, args [][]byte) bool {
+	key := string(args[0])
+	var ttl time.Duration
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToLower(string(args[i])); opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ex", "px":
+			if i+1 >= len(args) || ttl != 0 {
+				w.writeError(errSyntax)
+				return false
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				w.writeError(errNotInteger)
+				return false
+			}
+			if n <= 0 || n > math.MaxInt64/int64(time.Second) {
+				w.writeError("ERR invalid expire time in 'set' command")
+				return false
+			}
+			if opt == "ex" {
+				ttl = time.Duration(n) * time.Second
+			} else {
+				ttl = time.Duration(n) * time.Millisecond
+			}
+		default:
+			w.writeError(errSyntax)
+			return false
+		}
+	}
+	if nx && xx {
+		w.writeError(errSyntax)
+		return false
+	}
+
+	version := jsonstore.AnyVersion
+	if nx || xx {
+		_, current, ok := srv.lookup(key)
+		if (nx && ok) || (xx && !ok) {
+			w.writeNil()
+			return false
+		}
+		version = current
+	}
+	newVersion, err := srv.store.CompareAndSetRaw(key, redisconv.ToJSON(args[1]), version)
+	if err == jsonstore.ErrVersionMismatch {
+		w.writeNil()
+		return false
+	}
+	if err != nil {
+		w.writeError("ERR " + err.Error())
+		return false
+	}
+	if ttl > 0 {
+		srv.setExpiry(key, newVersion, ttl)
+	} else {
+		srv.clearExpiry(key)
+	}
+	w.writeSimple("OK")
+	return false
+}
+
+func cmdDel(srv *Server, w *writer, args [][]byte) bool {
+	var n int64
+	for _, arg := range args {
+		key := string(arg)
+		if _, version, ok := srv.lookup(key); ok && srv.store.CompareAndDelete(key, version) == nil {
+			srv.clearExpiry(key)
+			n++
+		}
+	}
+	w.writeInt(n)
+	return false
+}
+
+func cmdExists(srv *Server, w *writer, args [][]byte) bool {
+	var n int64
+	for _, arg := range args {
+		if _, _, ok := srv.lookup(string(arg)); ok {
+			n++
+		}
+	}
+	w.writeInt(n)
+	return false
+}
+
+func cmdKeys(srv *Server, w *writer, args [][]byte) bool {
+	pattern := string(args[0])
+	keys := []string{}
+	for _, key := range srv.store.Keys() {
+		if redisconv.MatchPattern(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	w.writeStrings(keys)
+	return false
+}
+
+// cmdScan iterates the keys in the order of their hashes, and the cursor is the next hash.
+// So the keys which exist during the whole iteration are returned, as Redis guarantees.
+func cmdScan(srv *Server, w *writer, args [][]byte) bool {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		w.writeError("ERR invalid cursor")
+		return false
+	}
+	pattern := "*"
+	count := 10
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			w.writeError(errSyntax)
+			return false
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = string(args[i+1])
+		case "count":
+			n, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				w.writeError(errNotInteger)
+				return false
+			}
+			if n < 1 {
+				w.writeError(errSyntax)
+				return false
+			}
+			count = n
+		default:
+			w.writeError(errSyntax)
+			return false
+		}
+		i++
+	}
+
+	type hashedKey struct {
+		hash uint64
+		key  string
+	}
+	var candidates []hashedKey
+	for _, key := range srv.store.Keys() {
+		if h := hashString(key); h >= cursor {
+			candidates = append(candidates, hashedKey{h, key})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].hash != candidates[j].hash {
+			return candidates[i].hash < candidates[j].hash
+		}
+		return candidates[i].key < candidates[j].key
+	})
+
+	next := uint64(0)
+	if len(candidates) > count {
+		// keep the keys with the same hash in the same page.
+		last := candidates[count-1].hash
+		end := count
+		for end < len(candidates) && candidates[end].hash == last {
+			end++
+		}
+		if end < len(candidates) {
+			next = candidates[end].hash
+		}
+		candidates = candidates[:end]
+	}
+
+	keys := []string{}
+	for _, c := range candidates {
+		if redisconv.MatchPattern(pattern, c.key) {
+			keys = append(keys, c.key)
+		}
+	}
+	w.writeArrayHeader(2)
+	w.writeBulk([]byte(strconv.FormatUint(next, 10)))
+	w.writeStrings(keys)
+	return false
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+func cmdExpire(srv *Server, w *writer, args [][]byte) bool {
+	seconds, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || seconds > math.MaxInt64/int64(time.Second) || seconds < math.MinInt64/int64(time.Second) {
+		w.writeError(errNotInteger)
+		return false
+	}
+	srv.expireAfter(w, string(args[0]), time.Duration(seconds)*time.Second)
+	return false
+}
+
+func cmdPExpireAt(srv *Server, w *writer, args [][]byte) bool {
+	ms, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		w.writeError(errNotInteger)
+		return false
+	}
+	srv.expireAfter(w, string(args[0]), time.Until(time.Unix(0, 0).Add(time.Duration(ms)*time.Millisecond)))
+	return false
+}
+
+// expireAfter makes key expire after d, and removes it immediately if d is not positive.
+func (srv *Server) expireAfter(w *writer, key string, d time.Duration) {
+	_, version, ok := srv.lookup(key)
+	if !ok {
+		w.writeInt(0)
+		return
+	}
+	if d <= 0 {
+		if srv.store.CompareAndDelete(key, version) != nil {
+			w.writeInt(0)
+			return
+		}
+		srv.clearExpiry(key)
+		w.writeInt(1)
+		return
+	}
+	srv.setExpiry(key, version, d)
+	w.writeInt(1)
+}
+
+func cmdTTL(srv *Server, w *writer, args [][]byte) bool {
+	ttl, ok := srv.ttl(string(args[0]))
+	if ok && ttl > 0 {
+		// round up like Redis
+		ttl = (ttl + time.Second - 1) / time.Second
+	}
+	w.writeInt(int64(ttl))
+	return false
+}
+
+func cmdPTTL(srv *Server, w *writer, args [][]byte) bool {
+	ttl, ok := srv.ttl(string(args[0]))
+	if ok && ttl > 0 {
+		ttl = (ttl + time.Millisecond - 1) / time.Millisecond
+	}
+	w.writeInt(int64(ttl))
+	return false
+}
+
+// ttl returns the remaining time of key, or -2 if key does not exist and -1 if key has no expiration.
+// ok is true if the key has an expiration.
+func (srv *Server) ttl(key string) (time.Duration, bool) {
+	_, version, ok := srv.lookup(key)
+	if !ok {
+		return -2, false
+	}
+	srv.mu.Lock()
+	e := srv.expires[key]
+	srv.mu.Unlock()
+	if e == nil || e.version != version {
+		return -1, false
+	}
+	return time.Until(e.at), true
+}
+
+func cmdIncr(srv *Server, w *writer, args [][]byte) bool {
+	key := string(args[0])
+	for {
+		value, version, ok := srv.lookup(key)
+		var n int64
+		if ok {
+			var err error
+			n, err = strconv.ParseInt(string(redisconv.FromJSON(value)), 10, 64)
+			if err != nil || n == math.MaxInt64 {
+				w.writeError(errNotInteger)
+				return false
+			}
+		}
+		n++
+		newVersion, err := srv.store.CompareAndSetRaw(key, json.RawMessage(strconv.FormatInt(n, 10)), version)
+		if err == jsonstore.ErrVersionMismatch {
+			// another client has changed the value.
+			continue
+		}
+		if err != nil {
+			w.writeError("ERR " + err.Error())
+			return false
+		}
+		srv.moveExpiry(key, version, newVersion)
+		w.writeInt(n)
+		return false
+	}
+}
+
+func cmdDBSize(srv *Server, w *writer, args [][]byte) bool {
+	w.writeInt(int64(srv.store.Size()))
+	return false
+}
+
+func cmdPing(srv *Server, w *writer, args [][]byte) bool {
+	if len(args) == 1 {
+		w.writeBulk(args[0])
+		return false
+	}
+	w.writeSimple("PONG")
+	return false
+}
+
+func cmdEcho(srv *Server, w *writer, args [][]byte) bool {
+	w.writeBulk(args[0])
+	return false
+}
+
+func cmdSelect(srv *Server, w *writer, args [][]byte) bool {
+	if string(args[0]) != "0" {
+		w.writeError("ERR DB index is out of range")
+		return false
+	}
+	w.writeSimple("OK")
+	return false
+}
+
+func cmdQuit(srv *Server, w *writer, args [][]byte) bool {
+	w.writeSimple("OK")
+	return true
+}
+
+// cmdCommand replies an empty list, which is enough for redis-cli.
+func cmdCommand(srv *Server, w *writer, args [][]byte) bool {
+	w.writeArrayHeader(0)
+	return false
+}
@@ -0,0 +1,151 @@
+package jsonstoreresp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+const (
+	// maxBulkLen is the maximum length of a bulk string in requests, the same as Redis.
+	maxBulkLen = 512 << 20
+
+	// maxArrayLen is the maximum number of arguments of a request.
+	maxArrayLen = 1 << 20
+)
+
+var errProtocol = errors.New("jsonstoreresp: protocol error")
+
+// reader reads the requests of RESP2.
+type reader struct {
+	r *bufio.Reader
+}
+
+func newReader(r io.Reader) *reader {
+	return &reader{r: bufio.NewReader(r)}
+}
+
+func (r *reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errProtocol
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+// readCommand reads a command, which is an array of bulk strings or an inline command.
+func (r *reader) readCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		// inline command, which is used by telnet
+		fields := bytes.Fields(line)
+		args := make([][]byte, len(fields))
+		for i, f := range fields {
+			args[i] = append([]byte(nil), f...)
+		}
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArrayLen {
+		return nil, errProtocol
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+		l, err := strconv.Atoi(string(line[1:]))
+		if err != nil || l < 0 || l > maxBulkLen {
+			return nil, errProtocol
+		}
+		buf := make([]byte, l+2)
+		if _, err := io.ReadFull(r.r, buf); err != nil {
+			return nil, err
+		}
+		if buf[l] != '\r' || buf[l+1] != '\n' {
+			return nil, errProtocol
+		}
+		args = append(args, buf[:l])
+	}
+	return args, nil
+}
+
+// buffered reports whether the next request has been already received.
+func (r *reader) buffered() bool {
+	return r.r.Buffered() > 0
+}
+
+// writer writes the replies of RESP2.
+type writer struct {
+	w *bufio.Writer
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{w: bufio.NewWriter(w)}
+}
+
+func (w *writer) writeSimple(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) writeError(s string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) writeInt(n int64) {
+	w.w.WriteByte(':')
+	w.w.WriteString(strconv.FormatInt(n, 10))
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) writeBulk(b []byte) {
+	w.w.WriteByte('$')
+	w.w.WriteString(strconv.Itoa(len(b)))
+	w.w.WriteString("\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) writeNil() {
+	w.w.WriteString("$-1\r\n")
+}
+
+func (w *writer) writeArrayHeader(n int) {
+	w.w.WriteByte('*')
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) writeStrings(s []string) {
+	w.writeArrayHeader(len(s))
+	for _, v := range s {
+		w.writeBulk([]byte(v))
+	}
+}
+
+func (w *writer) flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,186 @@
+// Package jsonstoreresp serves a JSONStore with the Redis protocol (RESP2),
+// so Redis clients and tools can talk to the file-backed store.
+//
+// The server supports GET, SET (with EX, PX, NX and XX), DEL, EXISTS, KEYS, SCAN,
+// EXPIRE, PEXPIREAT, TTL, PTTL, INCR, DBSIZE, PING, ECHO, SELECT 0 and QUIT.
+//
+// Redis strings are stored as JSON strings, so GET returns the same bytes as SET
+// (except for invalid UTF-8, which is replaced with U+FFFD).
+// The values which are not JSON strings, such as the ones set by JSONStore.Set, are returned as JSON text.
+//
+// The expiration is kept in memory by the server; it is not saved with the store.
+// The server has no authentication, so ListenAndServe accepts only Unix sockets and loopback addresses.
+package jsonstoreresp
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+// ErrServerClosed is returned by Serve after Close is called.
+var ErrServerClosed = errors.New("jsonstoreresp: server closed")
+
+// Server serves a JSONStore with the Redis protocol.
+type Server struct {
+	store *jsonstore.JSONStore
+
+	mu        sync.Mutex
+	expires   map[string]*expiry
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// expiry is the expiration of a key.
+// It applies only while the key has the version.
+type expiry struct {
+	version int64
+	at      time.Time
+	timer   *time.Timer
+}
+
+// NewServer returns a new server of s.
+func NewServer(s *jsonstore.JSONStore) *Server {
+	return &Server{
+		store:     s,
+		expires:   map[string]*expiry{},
+		listeners: map[net.Listener]struct{}{},
+		conns:     map[net.Conn]struct{}{},
+	}
+}
+
+// ListenAndServe listens on a Unix socket or a loopback TCP address, and serves the connections.
+func (srv *Server) ListenAndServe(network, addr string) error {
+	switch network {
+	case "unix":
+	case "tcp", "tcp4", "tcp6":
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return errors.New("jsonstoreresp: " + addr + " is not a loopback address")
+		}
+	default:
+		return errors.New("jsonstoreresp: unsupported network " + network)
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(l)
+}
+
+// Serve accepts the connections on l and serves them.
+// It always returns a non-nil error, and closes l.
+func (srv *Server) Serve(l net.Listener) error {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	srv.listeners[l] = struct{}{}
+	srv.mu.Unlock()
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.listeners, l)
+		srv.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			srv.mu.Lock()
+			closed := srv.closed
+			srv.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		srv.mu.Lock()
+		if srv.closed {
+			srv.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		srv.conns[conn] = struct{}{}
+		srv.mu.Unlock()
+		go srv.serveConn(conn)
+	}
+}
+
+// Close closes the listeners and the connections, and cancels the expirations.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.closed = true
+	for l := range srv.listeners {
+		l.Close()
+	}
+	for c := range srv.conns {
+		c.Close()
+	}
+	for key, e := range srv.expires {
+		e.timer.Stop()
+		delete(srv.expires, key)
+	}
+	return nil
+}
+
+func (srv *Server) serveConn(conn net.Conn) {
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.conns, conn)
+		srv.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := newReader(conn)
+	w := newWriter(conn)
+	for {
+		args, err := r.readCommand()
+		if err != nil {
+			if err == errProtocol {
+				w.writeError("ERR Protocol error")
+				w.flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := srv.execute(w, args)
+		// flush after the pipelined commands are executed.
+		if quit || !r.buffered() {
+			if err := w.flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// execute executes a command, and reports whether the connection should be closed.
+func (srv *Server) execute(w *writer, args [][]byte) bool {
+	name := strings.ToLower(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		w.writeError("ERR unknown command '" + string(args[0]) + "'")
+		return false
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		w.writeError("ERR wrong number of arguments for '" + name + "' command")
+		return false
+	}
+	return cmd.fn(srv, w, args[1:])
+}
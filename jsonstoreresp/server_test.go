@@ -0,0 +1,299 @@
+package jsonstoreresp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+// client is a minimal RESP2 client for testing.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func setupServer(t *testing.T) (*jsonstore.JSONStore, *client) {
+	ks := new(jsonstore.JSONStore)
+	srv := NewServer(ks)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ks, &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *client) send(args ...string) {
+	c.t.Helper()
+	buf := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		buf += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, buf); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// do sends a command and returns the reply.
+// The reply is a string, an int64, nil, an error or a []interface{}.
+func (c *client) do(args ...string) interface{} {
+	c.t.Helper()
+	c.send(args...)
+	return c.reply()
+}
+
+func (c *client) reply() interface{} {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return errors.New(line[1:])
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		a := make([]interface{}, n)
+		for i := range a {
+			a[i] = c.reply()
+		}
+		return a
+	}
+	c.t.Fatalf("unexpected reply: %q", line)
+	return nil
+}
+
+func TestGetSet(t *testing.T) {
+	ks, c := setupServer(t)
+
+	if got := c.do("SET", "hello", "world"); got != "OK" {
+		t.Errorf("want OK, got %v", got)
+	}
+	if got := c.do("GET", "hello"); got != "world" {
+		t.Errorf("want world, got %v", got)
+	}
+	var s string
+	if err := ks.Get("hello", &s); err != nil || s != "world" {
+		t.Errorf("want world, got %q, %v", s, err)
+	}
+
+	// strings which look like JSON are stored as strings, so they round-trip.
+	for _, v := range []string{`{"Name": "Dante", "Height": 5.4}`, `"x"`, ` 1`, `null`} {
+		c.do("SET", "json", v)
+		if got := c.do("GET", "json"); got != v {
+			t.Errorf("want %q, got %q", v, got)
+		}
+		if err := ks.Get("json", &s); err != nil || s != v {
+			t.Errorf("want %q, got %q, %v", v, s, err)
+		}
+	}
+
+	// JSON values which are not strings are returned as JSON text.
+	ks.Set("human", struct{ Name string }{"Dante"})
+	if got := c.do("GET", "human"); got != `{"Name":"Dante"}` {
+		t.Errorf("unexpected value: %v", got)
+	}
+
+	if got := c.do("GET", "missing"); got != nil {
+		t.Errorf("want nil, got %v", got)
+	}
+
+	if got := c.do("SET", "hello", "again", "NX"); got != nil {
+		t.Errorf("want nil, got %v", got)
+	}
+	if got := c.do("SET", "missing", "value", "XX"); got != nil {
+		t.Errorf("want nil, got %v", got)
+	}
+	if got := c.do("SET", "new", "value", "NX"); got != "OK" {
+		t.Errorf("want OK, got %v", got)
+	}
+	if _, ok := c.do("SET", "hello", "world", "FOO").(error); !ok {
+		t.Error("want syntax error")
+	}
+	if _, ok := c.do("GET").(error); !ok {
+		t.Error("want arity error")
+	}
+	if _, ok := c.do("UNKNOWN").(error); !ok {
+		t.Error("want unknown command error")
+	}
+}
+
+func TestDelExists(t *testing.T) {
+	_, c := setupServer(t)
+	c.do("SET", "a", "1")
+	c.do("SET", "b", "2")
+
+	if got := c.do("EXISTS", "a", "b", "c", "a"); got != int64(3) {
+		t.Errorf("want 3, got %v", got)
+	}
+	if got := c.do("DEL", "a", "c"); got != int64(1) {
+		t.Errorf("want 1, got %v", got)
+	}
+	if got := c.do("DBSIZE"); got != int64(1) {
+		t.Errorf("want 1, got %v", got)
+	}
+}
+
+func TestKeysScan(t *testing.T) {
+	_, c := setupServer(t)
+	for i := 0; i < 50; i++ {
+		c.do("SET", "human:"+strconv.Itoa(i), "x")
+		c.do("SET", "dog:"+strconv.Itoa(i), "x")
+	}
+
+	got := c.do("KEYS", "human:?")
+	want := []interface{}{}
+	for i := 0; i < 10; i++ {
+		want = append(want, "human:"+strconv.Itoa(i))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	seen := map[string]bool{}
+	cursor := "0"
+	for i := 0; ; i++ {
+		if i > 100 {
+			t.Fatal("SCAN does not finish")
+		}
+		reply := c.do("SCAN", cursor, "MATCH", "human:*", "COUNT", "7").([]interface{})
+		for _, key := range reply[1].([]interface{}) {
+			seen[key.(string)] = true
+		}
+		cursor = reply[0].(string)
+		if cursor == "0" {
+			break
+		}
+	}
+	if len(seen) != 50 {
+		t.Errorf("want 50 keys, got %d", len(seen))
+	}
+}
+
+func TestExpire(t *testing.T) {
+	ks, c := setupServer(t)
+
+	c.do("SET", "a", "1")
+	if got := c.do("TTL", "a"); got != int64(-1) {
+		t.Errorf("want -1, got %v", got)
+	}
+	if got := c.do("TTL", "missing"); got != int64(-2) {
+		t.Errorf("want -2, got %v", got)
+	}
+	if got := c.do("EXPIRE", "a", "100"); got != int64(1) {
+		t.Errorf("want 1, got %v", got)
+	}
+	if got := c.do("TTL", "a"); got != int64(100) {
+		t.Errorf("want 100, got %v", got)
+	}
+	if got := c.do("EXPIRE", "missing", "100"); got != int64(0) {
+		t.Errorf("want 0, got %v", got)
+	}
+
+	// INCR keeps the expiration, and SET clears it
+	c.do("INCR", "a")
+	if got := c.do("TTL", "a"); got != int64(100) {
+		t.Errorf("want 100, got %v", got)
+	}
+	c.do("SET", "a", "1")
+	if got := c.do("TTL", "a"); got != int64(-1) {
+		t.Errorf("want -1, got %v", got)
+	}
+
+	c.do("SET", "b", "1", "PX", "10")
+	time.Sleep(50 * time.Millisecond)
+	if got := c.do("GET", "b"); got != nil {
+		t.Errorf("want nil, got %v", got)
+	}
+	if _, err := ks.GetRaw("b"); err == nil {
+		t.Error("expired key must be removed from the store")
+	}
+
+	at := time.Now().Add(time.Minute).UnixNano() / int64(time.Millisecond)
+	if got := c.do("PEXPIREAT", "a", strconv.FormatInt(at, 10)); got != int64(1) {
+		t.Errorf("want 1, got %v", got)
+	}
+	if got, ok := c.do("PTTL", "a").(int64); !ok || got <= 59000 || got > 60000 {
+		t.Errorf("want about 60000, got %v", got)
+	}
+
+	c.do("EXPIRE", "a", "0")
+	if got := c.do("EXISTS", "a"); got != int64(0) {
+		t.Errorf("want 0, got %v", got)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	_, c := setupServer(t)
+	if got := c.do("INCR", "counter"); got != int64(1) {
+		t.Errorf("want 1, got %v", got)
+	}
+	if got := c.do("INCR", "counter"); got != int64(2) {
+		t.Errorf("want 2, got %v", got)
+	}
+	c.do("SET", "str", "10")
+	if got := c.do("INCR", "str"); got != int64(11) {
+		t.Errorf("want 11, got %v", got)
+	}
+	c.do("SET", "str", "hello")
+	if _, ok := c.do("INCR", "str").(error); !ok {
+		t.Error("want error")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	_, c := setupServer(t)
+	c.send("SET", "a", "1")
+	c.send("INCR", "a")
+	c.send("GET", "a")
+	c.send("PING")
+	want := []interface{}{"OK", int64(2), "2", "PONG"}
+	for _, w := range want {
+		if got := c.reply(); got != w {
+			t.Errorf("want %v, got %v", w, got)
+		}
+	}
+	if got := c.do("QUIT"); got != "OK" {
+		t.Errorf("want OK, got %v", got)
+	}
+}
+
+func TestListenAndServe(t *testing.T) {
+	srv := NewServer(new(jsonstore.JSONStore))
+	if err := srv.ListenAndServe("tcp", "192.0.2.1:6379"); err == nil {
+		t.Error("want error for non-loopback addresses")
+	}
+}
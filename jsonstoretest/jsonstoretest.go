@@ -0,0 +1,230 @@
+// Package jsonstoretest provides the conformance tests of jsonstore.Store implementations.
+//
+// A test of an implementation calls Run with a function creating stores:
+//
+//	func TestMyStore(t *testing.T) {
+//		jsonstoretest.Run(t, func(t *testing.T, data map[string]json.RawMessage) jsonstore.Store {
+//			return NewMyStore(data)
+//		})
+//	}
+package jsonstoretest
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+// NewStoreFunc returns a new store holding data.
+type NewStoreFunc func(t *testing.T, data map[string]json.RawMessage) jsonstore.Store
+
+// Human is the type of the values in the test data.
+type Human struct {
+	Name   string
+	Height float64
+}
+
+// Data returns the initial data of the stores under test.
+func Data() map[string]json.RawMessage {
+	return map[string]json.RawMessage{
+		"human:1": json.RawMessage(`{"Name":"Dante","Height":5.4}`),
+		"human:2": json.RawMessage(`{"Name":"Virgil","Height":5.8}`),
+		"dog:1":   json.RawMessage(`"Cerberus"`),
+		"empty":   json.RawMessage(`null`),
+	}
+}
+
+// Run runs the conformance tests against the stores created by newStore.
+// A store whose Set returns jsonstore.ErrReadOnly is tested as a read-only store.
+func Run(t *testing.T, newStore NewStoreFunc) {
+	t.Run("Get", func(t *testing.T) { testGet(t, newStore) })
+	t.Run("Keys", func(t *testing.T) { testKeys(t, newStore) })
+	t.Run("Range", func(t *testing.T) { testRange(t, newStore) })
+	t.Run("Set", func(t *testing.T) { testSet(t, newStore) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newStore) })
+}
+
+func testGet(t *testing.T, newStore NewStoreFunc) {
+	s := newStore(t, Data())
+
+	var human Human
+	if err := s.Get("human:1", &human); err != nil {
+		t.Fatal(err)
+	}
+	if human != (Human{"Dante", 5.4}) {
+		t.Errorf("want %v, got %v", Human{"Dante", 5.4}, human)
+	}
+
+	var name string
+	if err := s.Get("dog:1", &name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "Cerberus" {
+		t.Errorf("want Cerberus, got %s", name)
+	}
+
+	var v *Human
+	if err := s.Get("empty", &v); err != nil {
+		t.Fatal(err)
+	}
+	if v != nil {
+		t.Errorf("want nil, got %v", v)
+	}
+
+	err := s.Get("human:3", &human)
+	if _, ok := err.(jsonstore.NoSuchKeyError); !ok {
+		t.Errorf("want NoSuchKeyError, got %v", err)
+	}
+}
+
+func testKeys(t *testing.T, newStore NewStoreFunc) {
+	s := newStore(t, Data())
+	want := sortedKeys(Data())
+	got := s.Keys()
+	sort.Strings(got)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if s.Size() != len(want) {
+		t.Errorf("want %d, got %d", len(want), s.Size())
+	}
+
+	empty := newStore(t, map[string]json.RawMessage{})
+	if len(empty.Keys()) != 0 || empty.Size() != 0 {
+		t.Errorf("want empty, got %v", empty.Keys())
+	}
+}
+
+func testRange(t *testing.T, newStore NewStoreFunc) {
+	data := Data()
+	s := newStore(t, data)
+
+	seen := map[string]bool{}
+	s.Range(func(key string, value json.RawMessage) bool {
+		if seen[key] {
+			t.Errorf("duplicated key %s", key)
+		}
+		seen[key] = true
+		if !jsonEqual(value, data[key]) {
+			t.Errorf("%s: want %s, got %s", key, data[key], value)
+		}
+		return true
+	})
+	if len(seen) != len(data) {
+		t.Errorf("want %d keys, got %d", len(data), len(seen))
+	}
+
+	count := 0
+	s.Range(func(key string, value json.RawMessage) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Errorf("Range must stop when fn returns false, called %d times", count)
+	}
+}
+
+func testSet(t *testing.T, newStore NewStoreFunc) {
+	s := newStore(t, Data())
+
+	err := s.Set("human:3", Human{"Beatrice", 5.2})
+	if err == jsonstore.ErrReadOnly {
+		if _, ok := s.Get("human:3", &Human{}).(jsonstore.NoSuchKeyError); !ok {
+			t.Error("read-only store must not be modified")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var human Human
+	if err := s.Get("human:3", &human); err != nil {
+		t.Fatal(err)
+	}
+	if human != (Human{"Beatrice", 5.2}) {
+		t.Errorf("want %v, got %v", Human{"Beatrice", 5.2}, human)
+	}
+
+	// overwrite
+	if err := s.Set("human:3", Human{"Cato", 6.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Get("human:3", &human); err != nil {
+		t.Fatal(err)
+	}
+	if human.Name != "Cato" {
+		t.Errorf("want Cato, got %s", human.Name)
+	}
+	if s.Size() != len(Data())+1 {
+		t.Errorf("want %d, got %d", len(Data())+1, s.Size())
+	}
+
+	// the value is copied
+	tags := []string{"a"}
+	if err := s.Set("tags", tags); err != nil {
+		t.Fatal(err)
+	}
+	tags[0] = "b"
+	var got []string
+	if err := s.Get("tags", &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "a" {
+		t.Errorf("want [a], got %v", got)
+	}
+
+	// unsupported values are errors
+	if err := s.Set("func", func() {}); err == nil {
+		t.Error("want error, got nil")
+	}
+	if err := s.Get("func", &got); err == nil {
+		t.Error("the failed value must not be saved")
+	}
+}
+
+func testDelete(t *testing.T, newStore NewStoreFunc) {
+	s := newStore(t, Data())
+	readOnly := s.Set("probe", 1) == jsonstore.ErrReadOnly
+	size := s.Size()
+
+	s.Delete("human:1")
+	s.Delete("missing")
+
+	err := s.Get("human:1", &Human{})
+	if readOnly {
+		if err != nil || s.Size() != size {
+			t.Error("read-only store must not be modified")
+		}
+		return
+	}
+	if _, ok := err.(jsonstore.NoSuchKeyError); !ok {
+		t.Errorf("want NoSuchKeyError, got %v", err)
+	}
+	if s.Size() != size-1 {
+		t.Errorf("want %d, got %d", size-1, s.Size())
+	}
+}
+
+func sortedKeys(data map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
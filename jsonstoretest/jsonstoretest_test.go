@@ -0,0 +1,30 @@
+package jsonstoretest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shogo82148/jsonstore"
+)
+
+func newJSONStore(t *testing.T, data map[string]json.RawMessage) *jsonstore.JSONStore {
+	ks := new(jsonstore.JSONStore)
+	for k, v := range data {
+		if err := ks.SetRaw(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ks
+}
+
+func TestJSONStore(t *testing.T) {
+	Run(t, func(t *testing.T, data map[string]json.RawMessage) jsonstore.Store {
+		return newJSONStore(t, data)
+	})
+}
+
+func TestView(t *testing.T) {
+	Run(t, func(t *testing.T, data map[string]json.RawMessage) jsonstore.Store {
+		return newJSONStore(t, data).Snapshot()
+	})
+}
@@ -0,0 +1,136 @@
+package jsonstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned when a lock of a file is held by another process,
+// or when a store with a shared lock is saved to the locked file.
+var ErrLocked = errors.New("jsonstore: file is locked")
+
+// LockMode is the mode of a FileLock.
+type LockMode int
+
+const (
+	// LockShared is a lock for readers. Many processes can hold shared locks at once.
+	LockShared LockMode = iota
+
+	// LockExclusive is a lock for a writer. It excludes other shared and exclusive locks.
+	LockExclusive
+)
+
+// lockRetryInterval is the interval to retry locking until the timeout.
+const lockRetryInterval = 10 * time.Millisecond
+
+// FileLock is an advisory lock of a store file between processes.
+// The lock is taken on the sidecar file which has the ".lock" suffix,
+// so the store file can be replaced by SaveAndRename while it is locked.
+// The sidecar file is not removed, because removing it races with other processes locking it.
+type FileLock struct {
+	filename string // the absolute path of the store file
+	mode     LockMode
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Lock locks the store file. It retries until timeout, and returns ErrLocked if the lock is not taken.
+// If timeout is zero, it tries only once. If timeout is negative, it waits forever.
+func Lock(filename string, mode LockMode, timeout time.Duration) (*FileLock, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(abs+".lock", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLock(f, mode)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			return &FileLock{filename: abs, mode: mode, f: f}, nil
+		}
+		if timeout >= 0 && !time.Now().Before(deadline) {
+			f.Close()
+			return nil, ErrLocked
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// Mode returns the mode of the lock.
+func (l *FileLock) Mode() LockMode {
+	return l.mode
+}
+
+// Unlock releases the lock. It is safe to call Unlock twice.
+func (l *FileLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	// closing the file releases the lock.
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// checkWrite returns ErrLocked if filename is locked by the shared lock.
+func (l *FileLock) checkWrite(filename string) error {
+	if l == nil || l.mode == LockExclusive {
+		return nil
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if abs == l.filename {
+		return ErrLocked
+	}
+	return nil
+}
+
+// Close releases the lock taken by Options.Lock, and the memory shared by Options.ReadOnly.
+// A read-only store is empty after Close.
+// It does nothing for the other stores.
+func (s *JSONStore) Close() error {
+	s.Lock()
+	c := *s.getConfig()
+	l, sf := c.lock, c.shared
+	c.lock, c.shared = nil, nil
+	if sf != nil {
+		// drop the values, which may refer to the memory unmapped by release.
+		// Snapshot and GetAll take the values and a reference to sf while s is read-locked,
+		// so they never see the values without the reference.
+		for i := range s.shards {
+			sh := &s.shards[i]
+			sh.mu.Lock()
+			sh.tree.Store((*hamt)(nil))
+			sh.mu.Unlock()
+		}
+	}
+	s.config.Store(&c)
+	s.Unlock()
+
+	var err error
+	if sf != nil {
+		err = sf.release()
+	}
+	if l != nil {
+		if uerr := l.Unlock(); err == nil {
+			err = uerr
+		}
+	}
+	return err
+}
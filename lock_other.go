@@ -0,0 +1,13 @@
+//go:build !unix
+
+package jsonstore
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLock is not supported on this platform.
+func tryLock(f *os.File, mode LockMode) (bool, error) {
+	return false, errors.New("jsonstore: file locking is not supported on this platform")
+}
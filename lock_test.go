@@ -0,0 +1,122 @@
+//go:build unix
+
+package jsonstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "foo.jsonstore")
+
+	// flock is per open file, so the locks conflict in a process.
+	r1, err := Lock(filename, LockShared, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := Lock(filename, LockShared, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := Lock(filename, LockExclusive, 50*time.Millisecond); err != ErrLocked {
+		t.Errorf("want %v, got %v", ErrLocked, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("want waiting for the timeout, got %v", d)
+	}
+	r1.Unlock()
+	r2.Unlock()
+	r2.Unlock()
+
+	w, err := Lock(filename, LockExclusive, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Lock(filename, LockShared, 0); err != ErrLocked {
+		t.Errorf("want %v, got %v", ErrLocked, err)
+	}
+
+	// the waiter takes the lock after it is released.
+	done := make(chan error)
+	go func() {
+		l, err := Lock(filename, LockShared, time.Second)
+		if err == nil {
+			l.Unlock()
+		}
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	w.Unlock()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenFile_Lock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "foo.jsonstore")
+	ks := new(JSONStore)
+	ks.Set("hello", "world")
+	if err := Save(ks, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := OpenFile(filename, Options{Lock: &LockOptions{Mode: LockExclusive}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFile(filename, Options{Lock: &LockOptions{Mode: LockShared}}); err != ErrLocked {
+		t.Errorf("want %v, got %v", ErrLocked, err)
+	}
+	writer.Set("hello", "jsonstore")
+	if err := SaveAndRename(writer, filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := OpenFile(filename, Options{Lock: &LockOptions{Mode: LockShared}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var v string
+	if err := reader.Get("hello", &v); err != nil || v != "jsonstore" {
+		t.Errorf("want %q, got %q, %v", "jsonstore", v, err)
+	}
+	if err := SaveAndRename(reader, filename); err != ErrLocked {
+		t.Errorf("want %v, got %v", ErrLocked, err)
+	}
+	if err := Save(reader, filepath.Join(dir, "copy.jsonstore")); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	// the shared lock doesn't create the file.
+	missing := filepath.Join(dir, "missing.jsonstore")
+	shared, err := OpenFile(missing, Options{Create: true, Lock: &LockOptions{Mode: LockShared}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Close()
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("want not exist, got %v", err)
+	}
+	if err := shared.Save(); err != ErrLocked {
+		t.Errorf("want %v, got %v", ErrLocked, err)
+	}
+}
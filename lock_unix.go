@@ -0,0 +1,28 @@
+//go:build unix
+
+package jsonstore
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLock takes flock of f without blocking, and reports whether the lock is taken.
+func tryLock(f *os.File, mode LockMode) (bool, error) {
+	how := syscall.LOCK_SH
+	if mode == LockExclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		switch err {
+		case nil:
+			return true, nil
+		case syscall.EWOULDBLOCK:
+			return false, nil
+		case syscall.EINTR:
+			continue
+		}
+		return false, &os.PathError{Op: "flock", Path: f.Name(), Err: err}
+	}
+}
@@ -0,0 +1,152 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnresolved is returned by a ConflictResolver which can not resolve a conflict.
+var ErrUnresolved = errors.New("jsonstore: unresolved conflict")
+
+// Conflict is a key or a member which is changed differently in two stores.
+type Conflict struct {
+	Key string
+
+	// Path is the JSON Pointer to the conflicting member. It is empty for the whole value.
+	Path string
+
+	// Base, Ours and Theirs are the values. They are nil if the key or the member is missing.
+	Base, Ours, Theirs json.RawMessage
+}
+
+// ConflictResolver resolves a conflict of Merge.
+// It returns the merged value, or nil for removing the key or the member.
+// It returns ErrUnresolved if it can not resolve the conflict.
+type ConflictResolver func(c Conflict) (json.RawMessage, error)
+
+// ResolveOurs resolves conflicts by taking our value.
+func ResolveOurs(c Conflict) (json.RawMessage, error) {
+	return c.Ours, nil
+}
+
+// ResolveTheirs resolves conflicts by taking their value.
+func ResolveTheirs(c Conflict) (json.RawMessage, error) {
+	return c.Theirs, nil
+}
+
+// ResolveObjects resolves conflicts of objects by merging their members in three ways.
+// The conflicts of the members and the conflicts of non-object values are resolved by fallback.
+// If fallback is nil, they are unresolved.
+func ResolveObjects(fallback ConflictResolver) ConflictResolver {
+	var resolve ConflictResolver
+	resolve = func(c Conflict) (json.RawMessage, error) {
+		var base, ours, theirs map[string]json.RawMessage
+		if !decodeObject(c.Ours, &ours) || !decodeObject(c.Theirs, &theirs) ||
+			(c.Base != nil && !decodeObject(c.Base, &base)) {
+			if fallback == nil {
+				return nil, ErrUnresolved
+			}
+			return fallback(c)
+		}
+
+		merged := map[string]json.RawMessage{}
+		for _, name := range unionKeys(base, ours, theirs) {
+			v, err := merge3(Conflict{
+				Key:    c.Key,
+				Path:   c.Path + "/" + escapePointer(name),
+				Base:   base[name],
+				Ours:   ours[name],
+				Theirs: theirs[name],
+			}, resolve)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				merged[name] = v
+			}
+		}
+		return json.Marshal(merged)
+	}
+	return resolve
+}
+
+func decodeObject(raw json.RawMessage, v *map[string]json.RawMessage) bool {
+	if !isJSONObject(raw) {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+// MergeConflictError is returned by Merge if some conflicts are not resolved.
+type MergeConflictError struct {
+	Conflicts []Conflict
+}
+
+func (err *MergeConflictError) Error() string {
+	keys := make([]string, 0, len(err.Conflicts))
+	for _, c := range err.Conflicts {
+		keys = append(keys, c.Key)
+	}
+	return fmt.Sprintf("jsonstore: %d unresolved conflicts: %s", len(keys), strings.Join(keys, ", "))
+}
+
+// Merge merges the changes of ours and theirs from base in three ways.
+// A key changed only in one side takes the changed value.
+// A key changed differently in both sides is a conflict, which is resolved by resolve.
+// If resolve is nil or returns ErrUnresolved, the key keeps our value, and Merge returns
+// the merged store with a *MergeConflictError.
+// The sensitive fields are merged decrypted, and encrypted again with the keys of ours.
+// The merged store has the settings of ours except auto saving.
+func Merge(base, ours, theirs *JSONStore, resolve ConflictResolver) (*JSONStore, error) {
+	db := base.snapshot(false).plainData()
+	do := ours.snapshot(false).plainData()
+	dt := theirs.snapshot(false).plainData()
+
+	merged := make(map[string]json.RawMessage, len(do))
+	var conflicts []Conflict
+	for _, key := range unionKeys(db, do, dt) {
+		c := Conflict{Key: key, Base: db[key], Ours: do[key], Theirs: dt[key]}
+		v, err := merge3(c, resolve)
+		if err == ErrUnresolved {
+			conflicts = append(conflicts, c)
+			v = c.Ours
+		} else if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			merged[key] = v
+		}
+	}
+
+	c := ours.getConfig()
+	for key, v := range merged {
+		v, err := c.encryptFields(key, v)
+		if err != nil {
+			return nil, err
+		}
+		merged[key] = v
+	}
+	ks := newJSONStore(merged, c)
+	if len(conflicts) > 0 {
+		return ks, &MergeConflictError{Conflicts: conflicts}
+	}
+	return ks, nil
+}
+
+// merge3 merges a value in three ways.
+func merge3(c Conflict, resolve ConflictResolver) (json.RawMessage, error) {
+	switch {
+	case rawEqual(c.Ours, c.Theirs):
+		return c.Ours, nil
+	case rawEqual(c.Base, c.Ours):
+		return c.Theirs, nil
+	case rawEqual(c.Base, c.Theirs):
+		return c.Ours, nil
+	}
+	if resolve == nil {
+		return nil, ErrUnresolved
+	}
+	return resolve(c)
+}
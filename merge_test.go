@@ -0,0 +1,79 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func storeData(ks *JSONStore) map[string]string {
+	data := map[string]string{}
+	ks.Range(func(key string, value json.RawMessage) bool {
+		data[key] = string(value)
+		return true
+	})
+	return data
+}
+
+func TestMerge(t *testing.T) {
+	base := newStoreFromJSON(t, `{"same":1,"ours":1,"theirs":1,"both":1,"deleted":1,"conflict":1}`)
+	ours := newStoreFromJSON(t, `{"same":1,"ours":2,"theirs":1,"both":3,"conflict":2,"new":1}`)
+	theirs := newStoreFromJSON(t, `{"same":1,"ours":1,"theirs":2,"both":3,"deleted":1,"conflict":3}`)
+
+	merged, err := Merge(base, ours, theirs, nil)
+	cerr, ok := err.(*MergeConflictError)
+	if !ok {
+		t.Fatalf("want MergeConflictError, got %v", err)
+	}
+	if len(cerr.Conflicts) != 1 || cerr.Conflicts[0].Key != "conflict" {
+		t.Errorf("unexpected conflicts: %v", cerr.Conflicts)
+	}
+	want := map[string]string{"same": "1", "ours": "2", "theirs": "2", "both": "3", "conflict": "2", "new": "1"}
+	if got := storeData(merged); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	merged, err = Merge(base, ours, theirs, ResolveTheirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := storeData(merged)["conflict"]; got != "3" {
+		t.Errorf("want 3, got %s", got)
+	}
+}
+
+func TestMergeObjects(t *testing.T) {
+	base := newStoreFromJSON(t, `{"human":{"Name":"Dante","Height":5.4,"Tags":{"a":1}}}`)
+	ours := newStoreFromJSON(t, `{"human":{"Name":"Durante","Height":5.4,"Tags":{"a":1,"b":2}}}`)
+	theirs := newStoreFromJSON(t, `{"human":{"Name":"Dante","Height":5.5,"Tags":{"a":1,"c":3}}}`)
+
+	merged, err := Merge(base, ours, theirs, ResolveObjects(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Height":5.5,"Name":"Durante","Tags":{"a":1,"b":2,"c":3}}`
+	if got := storeData(merged)["human"]; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	// conflicts of members are passed to the fallback
+	theirs = newStoreFromJSON(t, `{"human":{"Name":"Alighieri","Height":5.4,"Tags":{"a":1}}}`)
+	if _, err := Merge(base, ours, theirs, ResolveObjects(nil)); err == nil {
+		t.Error("want conflict")
+	}
+	var conflict Conflict
+	merged, err = Merge(base, ours, theirs, ResolveObjects(func(c Conflict) (json.RawMessage, error) {
+		conflict = c
+		return c.Theirs, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conflict.Key != "human" || conflict.Path != "/Name" {
+		t.Errorf("unexpected conflict: %+v", conflict)
+	}
+	want = `{"Height":5.4,"Name":"Alighieri","Tags":{"a":1,"b":2}}`
+	if got := storeData(merged)["human"]; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,77 @@
+package jsonstore
+
+import (
+	"reflect"
+)
+
+// DecodeOptions controls how Get decodes values.
+type DecodeOptions struct {
+	// UseNumber causes Get to unmarshal a number into an interface{} as a json.Number
+	// instead of as a float64.
+	UseNumber bool
+
+	// DisallowUnknownFields causes Get to return an error when the destination is a struct
+	// and the value contains object keys which do not match any non-ignored, exported fields.
+	DisallowUnknownFields bool
+
+	// Unmarshalers overrides decoding for specific types.
+	// The key is the type that v points to, and the function is called
+	// instead of the codec.
+	Unmarshalers map[reflect.Type]func(data []byte, v interface{}) error
+}
+
+// EncodeOptions controls how Set encodes values.
+type EncodeOptions struct {
+	// DisableHTMLEscape stops escaping of <, >, and & in JSON strings.
+	DisableHTMLEscape bool
+
+	// Prefix and Indent are passed to json.Encoder.SetIndent.
+	// The value is not indented if both are empty.
+	Prefix string
+	Indent string
+}
+
+// SetDecodeOptions sets the default options for Get.
+func (s *JSONStore) SetDecodeOptions(opts DecodeOptions) {
+	s.updateConfig(func(c *config) {
+		c.decodeOpts = opts
+	})
+}
+
+// SetEncodeOptions sets the default options for Set.
+func (s *JSONStore) SetEncodeOptions(opts EncodeOptions) {
+	s.updateConfig(func(c *config) {
+		c.encodeOpts = opts
+	})
+}
+
+// GetWithOptions is like Get, but it uses opts instead of the default options of the store.
+func (s *JSONStore) GetWithOptions(key string, v interface{}, opts DecodeOptions) error {
+	b, err := s.GetRawUnsafe(key)
+	if err != nil {
+		return err
+	}
+	return unmarshal(s.getConfig().getCodec(), b, v, opts)
+}
+
+// SetWithOptions is like Set, but it uses opts instead of the default options of the store.
+func (s *JSONStore) SetWithOptions(key string, value interface{}, opts EncodeOptions) error {
+	b, err := s.getConfig().getCodec().Marshal(value, opts)
+	if err != nil {
+		return err
+	}
+	return s.set(key, b)
+}
+
+func (opts EncodeOptions) isZero() bool {
+	return !opts.DisableHTMLEscape && opts.Prefix == "" && opts.Indent == ""
+}
+
+func unmarshal(codec Codec, data []byte, v interface{}, opts DecodeOptions) error {
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Ptr {
+		if f, ok := opts.Unmarshalers[t.Elem()]; ok {
+			return f(data, v)
+		}
+	}
+	return codec.Unmarshal(data, v, opts)
+}
@@ -0,0 +1,106 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeOptions(t *testing.T) {
+	ks := new(JSONStore)
+	ks.SetRaw("id", json.RawMessage(`{"id":9007199254740993}`))
+	ks.SetRaw("human:1", json.RawMessage(`{"Name":"Dante","Height":5.4,"Age":30}`))
+
+	// default options
+	var v map[string]interface{}
+	if err := ks.Get("id", &v); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v["id"].(float64); !ok {
+		t.Errorf("want float64, got %T", v["id"])
+	}
+	var human Human
+	if err := ks.Get("human:1", &human); err != nil {
+		t.Fatal(err)
+	}
+
+	// per-call options
+	v = nil
+	if err := ks.GetWithOptions("id", &v, DecodeOptions{UseNumber: true}); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := v["id"].(json.Number); !ok || n.String() != "9007199254740993" {
+		t.Errorf("want json.Number 9007199254740993, got %#v", v["id"])
+	}
+
+	// store-wide options
+	ks.SetDecodeOptions(DecodeOptions{DisallowUnknownFields: true})
+	if err := ks.Get("human:1", &human); err == nil || !strings.Contains(err.Error(), "Age") {
+		t.Errorf("want unknown field error, got %v", err)
+	}
+}
+
+func TestDecodeOptionsUnmarshalers(t *testing.T) {
+	ks := new(JSONStore)
+	ks.Set("human:1", Human{"Dante", 5.4})
+
+	errHook := errors.New("hook")
+	var called bool
+	opts := DecodeOptions{
+		Unmarshalers: map[reflect.Type]func(data []byte, v interface{}) error{
+			reflect.TypeOf(Human{}): func(data []byte, v interface{}) error {
+				called = true
+				if string(data) != `{"Name":"Dante","Height":5.4}` {
+					t.Errorf("unexpected data: %s", data)
+				}
+				v.(*Human).Name = "Virgil"
+				return errHook
+			},
+		},
+	}
+
+	var human Human
+	if err := ks.GetWithOptions("human:1", &human, opts); err != errHook {
+		t.Errorf("want errHook, got %v", err)
+	}
+	if !called || human.Name != "Virgil" {
+		t.Errorf("the hook is not called: %v", human)
+	}
+
+	// other types use the default decoder
+	var m map[string]interface{}
+	if err := ks.GetWithOptions("human:1", &m, opts); err != nil {
+		t.Fatal(err)
+	}
+	if m["Name"] != "Dante" {
+		t.Errorf("want Dante, got %v", m["Name"])
+	}
+}
+
+func TestEncodeOptions(t *testing.T) {
+	ks := new(JSONStore)
+	if err := ks.Set("html", "<b>&</b>"); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ks.GetRaw("html"); string(b) != `"\u003cb\u003e\u0026\u003c/b\u003e"` {
+		t.Errorf("unexpected encoding: %s", b)
+	}
+
+	if err := ks.SetWithOptions("html", "<b>&</b>", EncodeOptions{DisableHTMLEscape: true}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ks.GetRaw("html"); string(b) != `"<b>&</b>"` {
+		t.Errorf("unexpected encoding: %s", b)
+	}
+
+	ks.SetEncodeOptions(EncodeOptions{Indent: "  "})
+	if err := ks.Set("human:1", Human{"Dante", 5.4}); err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"Name\": \"Dante\",\n  \"Height\": 5.4\n}"
+	if b, _ := ks.GetRaw("human:1"); string(b) != want {
+		t.Errorf("want %q, got %q", want, b)
+	}
+}
@@ -0,0 +1,87 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// MergePatch applies a JSON Merge Patch (RFC 7386) to the value of key,
+// and returns the patched value and its version.
+// A missing key is patched as null. The patched value is validated against
+// the registered schemas like the values saved by Set.
+// If version is not AnyVersion, the patch is applied only if the current version of key is version,
+// otherwise MergePatch returns ErrVersionMismatch.
+//
+// The members of the patched objects are sorted by their names.
+func (s *JSONStore) MergePatch(key string, patch json.RawMessage, version int64) (json.RawMessage, int64, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, patch); err != nil {
+		return nil, 0, ErrInvalidJSON
+	}
+	patch = buf.Bytes()
+
+	hash := hashKey(key)
+	for {
+		e, ok := s.shardFor(hash).load().Get(key, hash)
+		current := versionOf(e, ok)
+		if version != AnyVersion && current != version {
+			return nil, 0, ErrVersionMismatch
+		}
+		var target json.RawMessage
+		if ok {
+			var err error
+			target, err = s.getConfig().decryptFields(key, e.value)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		patched, err := mergePatch(target, patch)
+		if err != nil {
+			return nil, 0, err
+		}
+		newVersion, err := s.setVersion(key, patched, current)
+		if err == ErrVersionMismatch && version == AnyVersion {
+			// another goroutine has changed the value; patch it again.
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return append(json.RawMessage(nil), patched...), newVersion, nil
+	}
+}
+
+// mergePatch returns the result of applying patch to target.
+// Both must be valid JSON, or nil for target.
+func mergePatch(target, patch json.RawMessage) (json.RawMessage, error) {
+	if !isJSONObject(patch) {
+		return patch, nil
+	}
+	var p map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	t := map[string]json.RawMessage{}
+	if isJSONObject(target) {
+		if err := json.Unmarshal(target, &t); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range p {
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			delete(t, name)
+			continue
+		}
+		merged, err := mergePatch(t[name], value)
+		if err != nil {
+			return nil, err
+		}
+		t[name] = merged
+	}
+	return json.Marshal(t)
+}
+
+func isJSONObject(b json.RawMessage) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) > 0 && b[0] == '{'
+}
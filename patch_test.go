@@ -0,0 +1,80 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// the examples from RFC 7386 Appendix A
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		ks := new(JSONStore)
+		ks.SetRaw("key", json.RawMessage(tt.target))
+		got, _, err := ks.MergePatch("key", json.RawMessage(tt.patch), AnyVersion)
+		if err != nil {
+			t.Errorf("%s + %s: %v", tt.target, tt.patch, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s + %s: want %s, got %s", tt.target, tt.patch, tt.want, got)
+		}
+		stored, _ := ks.GetRaw("key")
+		if string(stored) != tt.want {
+			t.Errorf("%s + %s: want %s stored, got %s", tt.target, tt.patch, tt.want, stored)
+		}
+	}
+}
+
+func TestMergePatchVersion(t *testing.T) {
+	ks := new(JSONStore)
+
+	// a missing key is patched as null
+	_, version, err := ks.MergePatch("human", json.RawMessage(`{"name":"Dante"}`), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ks.MergePatch("human", json.RawMessage(`{"height":5.4}`), version+1); err != ErrVersionMismatch {
+		t.Errorf("want ErrVersionMismatch, got %v", err)
+	}
+	got, _, err := ks.MergePatch("human", json.RawMessage(`{"height":5.4}`), version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"height":5.4,"name":"Dante"}` {
+		t.Errorf("unexpected value: %s", got)
+	}
+	if _, _, err := ks.MergePatch("human", json.RawMessage(`{`), AnyVersion); err != ErrInvalidJSON {
+		t.Errorf("want ErrInvalidJSON, got %v", err)
+	}
+}
+
+func TestMergePatchValidation(t *testing.T) {
+	ks := new(JSONStore)
+	ks.RegisterSchemaPrefix("human:", MustCompileSchema([]byte(humanSchema)))
+	if err := ks.Set("human:1", Human{"Dante", 5.4}); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := ks.MergePatch("human:1", json.RawMessage(`{"Name":null}`), AnyVersion)
+	if _, ok := err.(*ValidationError); !ok {
+		t.Errorf("want ValidationError, got %v", err)
+	}
+}
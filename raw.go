@@ -0,0 +1,72 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidJSON is returned when a raw value is not valid JSON.
+var ErrInvalidJSON = errors.New("jsonstore: invalid JSON")
+
+// SetRaw saves a raw JSON value at the given key without re-marshalling it.
+// The value is validated and compacted, so it is stored the same way as Set stores values.
+// SetRaw copies value, so the caller may reuse it after the call.
+func (s *JSONStore) SetRaw(key string, value json.RawMessage) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err != nil {
+		return ErrInvalidJSON
+	}
+	return s.set(key, buf.Bytes())
+}
+
+// SetRawCanonical is like SetRaw, but it also canonicalizes the value.
+// The keys of objects are sorted and the strings are re-escaped,
+// so equivalent JSON documents are stored as the same bytes.
+// Numbers are kept as written.
+func (s *JSONStore) SetRawCanonical(key string, value json.RawMessage) error {
+	b, err := canonicalize(value)
+	if err != nil {
+		return err
+	}
+	return s.set(key, b)
+}
+
+// GetRaw returns the raw JSON value associated with a key.
+// The returned value is a copy, so the caller may modify it.
+func (s *JSONStore) GetRaw(key string) (json.RawMessage, error) {
+	b, err := s.GetRawUnsafe(key)
+	if err != nil {
+		return nil, err
+	}
+	return append(json.RawMessage(nil), b...), nil
+}
+
+// GetRawUnsafe returns the raw JSON value associated with a key without copying it.
+// The returned value is shared with the store, so the caller MUST NOT modify it.
+func (s *JSONStore) GetRawUnsafe(key string) (json.RawMessage, error) {
+	hash := hashKey(key)
+	e, ok := s.shardFor(hash).load().Get(key, hash)
+	if !ok {
+		return nil, NoSuchKeyError{key}
+	}
+	c := s.getConfig()
+	if c.limits.enabled() {
+		e.touch()
+	}
+	return c.decryptFields(key, e.value)
+}
+
+func canonicalize(value json.RawMessage) ([]byte, error) {
+	if !json.Valid(value) {
+		return nil, ErrInvalidJSON
+	}
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	// encoding/json sorts the keys of maps.
+	return json.Marshal(v)
+}
@@ -0,0 +1,107 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSetRaw(t *testing.T) {
+	ks := new(JSONStore)
+	raw := json.RawMessage(`{ "Name": "Dante", "Height": 5.4 }`)
+	if err := ks.SetRaw("human:1", raw); err != nil {
+		t.Fatal(err)
+	}
+
+	// the caller may reuse the buffer
+	raw[3] = 'X'
+
+	var human Human
+	if err := ks.Get("human:1", &human); err != nil {
+		t.Fatal(err)
+	}
+	if human.Name != "Dante" || human.Height != 5.4 {
+		t.Errorf("want %v, got %v", Human{"Dante", 5.4}, human)
+	}
+
+	got, err := ks.GetRaw("human:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"Name":"Dante","Height":5.4}` {
+		t.Errorf("want compacted JSON, got %s", got)
+	}
+
+	if err := ks.SetRaw("broken", json.RawMessage(`{"Name":`)); err != ErrInvalidJSON {
+		t.Errorf("want ErrInvalidJSON, got %v", err)
+	}
+	if _, err := ks.GetRaw("broken"); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestSetRawCanonical(t *testing.T) {
+	ks := new(JSONStore)
+	if err := ks.SetRawCanonical("a", json.RawMessage(`{"b": [1.50, {"z":1,"y":2}], "a": "A"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SetRawCanonical("b", json.RawMessage(`{"a":"A","b":[1.50,{"y":2,"z":1}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := ks.GetRawUnsafe("a")
+	b, _ := ks.GetRawUnsafe("b")
+	if string(a) != string(b) {
+		t.Errorf("want same bytes, got %s and %s", a, b)
+	}
+	if string(a) != `{"a":"A","b":[1.50,{"y":2,"z":1}]}` {
+		t.Errorf("unexpected canonical form: %s", a)
+	}
+
+	for _, in := range []string{``, `1 2`, `{"a":1}}`, `[1,]`} {
+		if err := ks.SetRawCanonical("c", json.RawMessage(in)); err != ErrInvalidJSON {
+			t.Errorf("%q: want ErrInvalidJSON, got %v", in, err)
+		}
+	}
+}
+
+func TestGetRaw(t *testing.T) {
+	ks := new(JSONStore)
+	ks.Set("hello", "world")
+
+	b, err := ks.GetRaw("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[1] = 'W'
+
+	b, err = ks.GetRawUnsafe("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `"world"` {
+		t.Errorf("GetRaw must return a copy, got %s", b)
+	}
+
+	if _, err := ks.GetRaw("missing"); err != (NoSuchKeyError{"missing"}) {
+		t.Errorf("want NoSuchKeyError, got %v", err)
+	}
+}
+
+func BenchmarkGetRaw(b *testing.B) {
+	ks := new(JSONStore)
+	ks.Set("human:1", Human{"Dante", 5.4})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ks.GetRaw("human:1")
+	}
+}
+
+func BenchmarkSetRaw(b *testing.B) {
+	ks := new(JSONStore)
+	raw := json.RawMessage(`{"Name":"Dante","Height":5.4}`)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ks.SetRaw("human:1", raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// sharedFile is the data of a file shared by the read-only handles.
+type sharedFile struct {
+	key   sharedKey
+	info  os.FileInfo
+	trees [shardCount]*hamt
+	refs  int
+	mem   []byte // the mapped memory, or nil
+}
+
+type sharedKey struct {
+	filename string
+	gzip     bool
+	mmap     bool
+}
+
+var sharedFiles = struct {
+	sync.Mutex
+	m map[sharedKey]*sharedFile
+}{m: map[sharedKey]*sharedFile{}}
+
+func openReadOnly(filename string, cfg *config, keys []*Key, mmap bool) (*JSONStore, error) {
+	if len(keys) > 0 {
+		ks, err := openFile(filename, cfg, keys)
+		if err != nil {
+			return nil, err
+		}
+		ks.updateConfig(func(c *config) {
+			c.readOnly = true
+		})
+		return ks, nil
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	gz := cfg.gzip(filename)
+	mmap = mmap && mmapSupported && !gz
+	key := sharedKey{filename: abs, gzip: gz, mmap: mmap}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedFiles.Lock()
+	defer sharedFiles.Unlock()
+	sf, ok := sharedFiles.m[key]
+	if !ok || !os.SameFile(sf.info, info) || !sf.info.ModTime().Equal(info.ModTime()) || sf.info.Size() != info.Size() {
+		if mmap {
+			sf, err = loadMmap(abs)
+		} else {
+			sf, err = loadShared(abs, cfg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sf.key = key
+		// the handles of the old file keep it until they are closed.
+		sharedFiles.m[key] = sf
+	}
+	sf.refs++
+
+	ks := newJSONStoreFromTrees(sf.trees, 0, cfg)
+	ks.clock = 1
+	ks.updateConfig(func(c *config) {
+		c.readOnly = true
+		c.shared = sf
+	})
+	return ks, nil
+}
+
+func loadShared(filename string, cfg *config) (*sharedFile, error) {
+	// stat before reading, so a change while reading is detected by the next open.
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	ks, err := openFile(filename, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	trees, _ := ks.trees()
+	return &sharedFile{info: info, trees: trees}, nil
+}
+
+func loadMmap(filename string) (*sharedFile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	mem, err := mmapFile(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	trees, err := parseMapped(filename, mem)
+	if err != nil {
+		munmap(mem)
+		return nil, err
+	}
+	return &sharedFile{info: info, trees: trees, mem: mem}, nil
+}
+
+// parseMapped builds the tries whose values refer to b.
+func parseMapped(filename string, b []byte) ([shardCount]*hamt, error) {
+	var trees [shardCount]*hamt
+	if bytes.HasPrefix(b, []byte(encMagic)) {
+		return trees, ErrWrongKey
+	}
+	b, count, err := verifyFooter(filename, b)
+	if err != nil {
+		return trees, err
+	}
+	if !json.Valid(b) {
+		return trees, &CorruptionError{Filename: filename, Reason: "invalid JSON"}
+	}
+	n := 0
+	err = eachMember(b, func(key string, value []byte) {
+		hash := hashKey(key)
+		i := shardIndex(hash)
+		var old *entry
+		trees[i], old = trees[i].Set(key, hash, &entry{value: value, version: 1})
+		if old == nil {
+			n++
+		}
+	})
+	if err != nil {
+		return trees, &CorruptionError{Filename: filename, Reason: "invalid JSON", Err: err}
+	}
+	return trees, verifyCount(filename, n, count)
+}
+
+// eachMember calls fn for each member of the JSON object b without copying the values.
+// b must be valid JSON.
+func eachMember(b []byte, fn func(key string, value []byte)) error {
+	i := skipSpace(b, 0)
+	if i >= len(b) || b[i] != '{' {
+		return errors.New("not an object")
+	}
+	i = skipSpace(b, i+1)
+	if i < len(b) && b[i] == '}' {
+		return nil
+	}
+	for i < len(b) {
+		end := skipValue(b, i)
+		var key string
+		if err := json.Unmarshal(b[i:end], &key); err != nil {
+			return err
+		}
+		i = skipSpace(b, end)
+		i = skipSpace(b, i+1) // ':'
+		end = skipValue(b, i)
+		// limit the capacity, so appending to the value never writes into b.
+		fn(key, b[i:end:end])
+		i = skipSpace(b, end)
+		if i < len(b) && b[i] == '}' {
+			return nil
+		}
+		i = skipSpace(b, i+1) // ','
+	}
+	return errors.New("unexpected end of JSON")
+}
+
+func skipSpace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\r' || b[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// skipValue returns the end of the JSON value which starts at b[i]. The value must be valid.
+func skipValue(b []byte, i int) int {
+	depth := 0
+	for i < len(b) {
+		switch b[i] {
+		case '"':
+			i = skipString(b, i)
+			if depth == 0 {
+				return i
+			}
+			continue
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth <= 0 {
+				// a closing bracket at depth 0 ends the enclosing value, not this one.
+				if depth == 0 {
+					i++
+				}
+				return i
+			}
+		case ',', ':', ' ', '\t', '\r', '\n':
+			if depth == 0 {
+				return i
+			}
+		}
+		i++
+	}
+	return i
+}
+
+// skipString returns the end of the JSON string which starts at b[i].
+func skipString(b []byte, i int) int {
+	for i++; i < len(b) && b[i] != '"'; i++ {
+		if b[i] == '\\' {
+			i++
+		}
+	}
+	return i + 1
+}
+
+// acquire adds a reference to the shared data, which is released by release.
+// The views and the stores derived from a read-only handle refer to the data after the handle is closed.
+func (sf *sharedFile) acquire() {
+	sharedFiles.Lock()
+	defer sharedFiles.Unlock()
+	sf.refs++
+}
+
+// detach returns a copy of value if it may refer to the mapped memory of a read-only handle,
+// so value can be kept after the memory is unmapped.
+func (c *config) detach(value json.RawMessage) json.RawMessage {
+	if c.shared == nil || c.shared.mem == nil || value == nil {
+		return value
+	}
+	return append(json.RawMessage(nil), value...)
+}
+
+// release releases the shared data of a read-only handle.
+func (sf *sharedFile) release() error {
+	sharedFiles.Lock()
+	defer sharedFiles.Unlock()
+	sf.refs--
+	if sf.refs > 0 {
+		return nil
+	}
+	if sharedFiles.m[sf.key] == sf {
+		delete(sharedFiles.m, sf.key)
+	}
+	if sf.mem != nil {
+		return munmap(sf.mem)
+	}
+	return nil
+}
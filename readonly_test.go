@@ -0,0 +1,206 @@
+package jsonstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"foo.jsonstore", "foo.jsonstore.gz"} {
+		for _, mmap := range []bool{false, true} {
+			filename := filepath.Join(dir, name)
+			ks := newStoreFromJSON(t, `{"a":1,"b":{"c":[1,"}]\""]},"d":"e"}`)
+			if err := SaveAndRename(ks, filename); err != nil {
+				t.Fatal(err)
+			}
+
+			r1, err := OpenFile(filename, Options{ReadOnly: true, Mmap: mmap})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := storeData(r1), storeData(ks); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s, %v: want %v, got %v", name, mmap, want, got)
+			}
+			if err := r1.Set("a", 2); err != ErrReadOnly {
+				t.Errorf("%s, %v: want %v, got %v", name, mmap, ErrReadOnly, err)
+			}
+			if err := r1.CompareAndDelete("a", AnyVersion); err != ErrReadOnly {
+				t.Errorf("%s, %v: want %v, got %v", name, mmap, ErrReadOnly, err)
+			}
+			r1.Delete("a")
+			if r1.Size() != 3 {
+				t.Errorf("%s, %v: want %d, got %d", name, mmap, 3, r1.Size())
+			}
+			r1.StartAutoSave(filename, time.Second, 1)
+			if r1.stop != nil {
+				t.Errorf("%s, %v: auto saving is started", name, mmap)
+			}
+			r1.StopAutoSave() // must not panic
+
+			// the handles share the data.
+			r2, err := OpenFile(filename, Options{ReadOnly: true, Mmap: mmap})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r1.shards[0].load() != r2.shards[0].load() {
+				t.Errorf("%s, %v: the data are not shared", name, mmap)
+			}
+
+			// the changed file is loaded again.
+			ks.Set("a", 3)
+			if err := SaveAndRename(ks, filename); err != nil {
+				t.Fatal(err)
+			}
+			r3, err := OpenFile(filename, Options{ReadOnly: true, Mmap: mmap})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var v int
+			if err := r3.Get("a", &v); err != nil || v != 3 {
+				t.Errorf("%s, %v: want %d, got %d, %v", name, mmap, 3, v, err)
+			}
+			if err := r1.Get("a", &v); err != nil || v != 1 {
+				t.Errorf("%s, %v: want %d, got %d, %v", name, mmap, 1, v, err)
+			}
+
+			// a copy is writable.
+			g := r1.GetAll(func(string) bool { return true })
+			if err := g.Set("a", 4); err != nil {
+				t.Errorf("%s, %v: want nil, got %v", name, mmap, err)
+			}
+			if err := g.Save(); err == nil {
+				t.Errorf("%s, %v: a copy overwrites the file", name, mmap)
+			}
+			g.Close()
+
+			for _, r := range []*JSONStore{r1, r2, r3} {
+				if err := r.Close(); err != nil {
+					t.Error(err)
+				}
+			}
+			if r1.Size() != 0 {
+				t.Errorf("%s, %v: want %d, got %d", name, mmap, 0, r1.Size())
+			}
+			if n := len(sharedFiles.m); n != 0 {
+				t.Errorf("%s, %v: want no shared files, got %d", name, mmap, n)
+			}
+			os.Remove(filename)
+		}
+	}
+}
+
+func TestOpenReadOnly_Release(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "foo.jsonstore")
+	if err := SaveAndRename(newStoreFromJSON(t, `{"a":1,"b":2}`), filename); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := OpenFile(filename, Options{ReadOnly: true, Mmap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf := ks.getConfig().shared
+	view := ks.Snapshot()
+	copied := ks.GetAll(nil)
+	if err := ks.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the view and the copy keep the shared data after the store is closed.
+	var v int
+	if err := view.Get("a", &v); err != nil || v != 1 {
+		t.Errorf("want %d, got %d, %v", 1, v, err)
+	}
+	if err := copied.Get("b", &v); err != nil || v != 2 {
+		t.Errorf("want %d, got %d, %v", 2, v, err)
+	}
+	view.Release()
+	view.Release()
+	if sf.refs != 1 {
+		t.Errorf("want %d, got %d", 1, sf.refs)
+	}
+	copied.Close()
+	if sf.refs != 0 {
+		t.Errorf("want %d, got %d", 0, sf.refs)
+	}
+	if n := len(sharedFiles.m); n != 0 {
+		t.Errorf("want no shared files, got %d", n)
+	}
+}
+
+func TestOpenReadOnly_Save(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "foo.jsonstore")
+	w, err := OpenFile(filename, Options{Create: true, AutoSaveCount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Set("a", strings.Repeat("x", 1<<16))
+	if err := Save(w, filename); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenFile(filename, Options{ReadOnly: true, Mmap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// the saves of the writer must not truncate the mapped file.
+	w.Set("a", "y")
+	w.StopAutoSave()
+	if err := Save(w, filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Save(); err != nil {
+		t.Fatal(err)
+	}
+	var v string
+	if err := r.Get("a", &v); err != nil || len(v) != 1<<16 {
+		t.Errorf("want %d bytes, got %d bytes, %v", 1<<16, len(v), err)
+	}
+}
+
+func TestEachMember(t *testing.T) {
+	in := ` { "a" : 1 , "b\"" : { "c" : [ 1 , "}]\"" ] } , "d":"e","f":true,"g":null,"h":-1.5e3}`
+	got := map[string]string{}
+	if err := eachMember([]byte(in), func(key string, value []byte) {
+		got[key] = string(value)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a":  "1",
+		`b"`: `{ "c" : [ 1 , "}]\"" ] }`,
+		"d":  `"e"`,
+		"f":  "true",
+		"g":  "null",
+		"h":  "-1.5e3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if err := eachMember([]byte(`{}`), func(string, []byte) { t.Error("unexpected call") }); err != nil {
+		t.Error(err)
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/shogo82148/jsonstore"
+	"github.com/shogo82148/jsonstore/jsonstoreredis"
 	redistest "github.com/soh335/go-test-redisserver"
 	redis "gopkg.in/redis.v5"
 )
@@ -178,3 +181,48 @@ func BenchmarkRedis(b *testing.B) {
 		)
 	}
 }
+
+func TestImportFromRedis(t *testing.T) {
+	s, err := redistest.NewServer(true, nil)
+	if err != nil {
+		t.Skip("redis is not installed")
+	}
+	defer s.Stop()
+
+	c := redis.NewClient(&redis.Options{
+		Network: "unix",
+		Addr:    s.Config["unixsocket"],
+	})
+	for i := 0; i < 100; i++ {
+		b, _ := json.Marshal(Human{"Dante", 5.4})
+		if err := c.Set(key(i), b, 0).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Set("session", "abc", time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	// other types are skipped
+	if err := c.RPush("list", "a", "b").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	ks := new(jsonstore.JSONStore)
+	expires := map[string]time.Time{}
+	n, err := jsonstoreredis.ImportAddr(ks, "unix", s.Config["unixsocket"], &jsonstoreredis.ImportOptions{
+		OnExpire: func(key string, at time.Time) { expires[key] = at },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 101 {
+		t.Errorf("want 101, got %d", n)
+	}
+	var human Human
+	if err := ks.Get(key(42), &human); err != nil || human.Name != "Dante" {
+		t.Errorf("want Dante, got %v, %v", human, err)
+	}
+	if _, ok := expires["session"]; !ok {
+		t.Error("the expiration of session is not imported")
+	}
+}
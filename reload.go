@@ -0,0 +1,238 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ReloadPolicy decides how a hot reload applies the file to the store.
+type ReloadPolicy int
+
+const (
+	// ReloadMerge applies only the keys changed in the file since the last load or save,
+	// and keeps the keys changed in the store since then.
+	ReloadMerge ReloadPolicy = iota
+
+	// ReloadReplace makes the store the same as the file.
+	// The keys which are not in the file are deleted, even if they are set in the store.
+	ReloadReplace
+)
+
+// DefaultReloadInterval is the polling interval used when HotReloadOptions.Interval is zero.
+const DefaultReloadInterval = time.Second
+
+// HotReloadOptions is the options of StartHotReload.
+type HotReloadOptions struct {
+	// Interval is the interval to check the file.
+	Interval time.Duration
+
+	// Policy decides how the changes in the file are applied.
+	Policy ReloadPolicy
+
+	// Keys decrypt the file if it is encrypted.
+	// If Keys is empty, the keys passed to OpenFile and the encryption key of the store are used.
+	Keys []*Key
+
+	// OnError is called when reloading fails, for example, the file is broken.
+	// The store is not changed by the failed reload.
+	OnError func(err error)
+}
+
+// reloadState is the file which the hot reload has seen last.
+// The saves of the store update it, so they are not taken for the changes from outside.
+type reloadState struct {
+	sync.Mutex
+	filename string // the absolute path
+	info     os.FileInfo
+	base     map[string]json.RawMessage
+}
+
+// StartHotReload starts watching filename, and reloads it when it changes on disk.
+// The changes are detected by polling the modification time, the size, and the identity of the file,
+// so the files replaced by SaveAndRename are also detected.
+// The file is decoded with the format and the codec of the store, and the keys which differ are set or deleted,
+// which delivers the events to Watch and OnChange.
+// The store is expected to be loaded from filename, because the file at the start is the base of ReloadMerge.
+// The saves of the store to filename become the new base, and they are not reloaded.
+func (s *JSONStore) StartHotReload(filename string, opts HotReloadOptions) error {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultReloadInterval
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	base, err := s.loadForReload(filename, opts.Keys)
+	if err != nil {
+		return err
+	}
+	r := &reloadState{filename: abs, info: info, base: base}
+
+	s.Lock()
+	if s.reloadStop != nil {
+		s.Unlock()
+		return errors.New("jsonstore: hot reload is already started")
+	}
+	s.reloadStop = make(chan struct{})
+	s.reloadDone = make(chan struct{})
+	s.reload = r
+	stop, done := s.reloadStop, s.reloadDone
+	s.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			r.Lock()
+			info, base := r.info, r.base
+			r.Unlock()
+			current, err := os.Stat(filename)
+			if err != nil {
+				// the file may be being replaced.
+				continue
+			}
+			if os.SameFile(info, current) && info.ModTime().Equal(current.ModTime()) && info.Size() == current.Size() {
+				continue
+			}
+			data, err := s.loadForReload(filename, opts.Keys)
+			r.Lock()
+			if r.info != info {
+				// the store has saved the file meanwhile.
+				r.Unlock()
+				continue
+			}
+			// record the file even if it is broken, so the error is not reported repeatedly.
+			r.info = current
+			if err == nil {
+				r.base = data
+			}
+			r.Unlock()
+			if err == nil {
+				err = s.applyReload(base, data, opts.Policy)
+			}
+			if err != nil && opts.OnError != nil {
+				opts.OnError(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// StopHotReload stops hot reloading.
+func (s *JSONStore) StopHotReload() {
+	s.Lock()
+	stop, done := s.reloadStop, s.reloadDone
+	s.reloadStop, s.reloadDone = nil, nil
+	s.reload = nil
+	s.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done // wait for reloading goroutine
+}
+
+// saveTo saves snapshot to filename, and makes it the base of the hot reload if the store watches filename.
+func (s *JSONStore) saveTo(snapshot *snapshot, filename string) error {
+	if err := saveAndRename(snapshot, filename); err != nil {
+		return err
+	}
+	s.RLock()
+	r := s.reload
+	s.RUnlock()
+	if r == nil {
+		return nil
+	}
+	if abs, err := filepath.Abs(filename); err != nil || abs != r.filename {
+		return nil
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil
+	}
+	data := snapshot.data()
+	r.Lock()
+	r.info, r.base = info, data
+	r.Unlock()
+	return nil
+}
+
+// loadForReload loads filename with the settings of the store.
+func (s *JSONStore) loadForReload(filename string, keys []*Key) (map[string]json.RawMessage, error) {
+	c := *s.getConfig()
+	if len(keys) == 0 {
+		keys = c.keys
+		if c.key != nil {
+			keys = append([]*Key{c.key}, keys...)
+		}
+	}
+	ks, err := openFile(filename, &c, keys)
+	if err != nil {
+		return nil, err
+	}
+	return ks.snapshot(false).data(), nil
+}
+
+// applyReload applies the changes from base to data, or the whole data with ReloadReplace.
+// ReloadMerge skips the keys changed in the store since base.
+// It returns the first error, but applies the other keys.
+func (s *JSONStore) applyReload(base, data map[string]json.RawMessage, policy ReloadPolicy) error {
+	var keys []string
+	if policy == ReloadReplace {
+		keys = unionKeys(s.snapshot(false).data(), data)
+	} else {
+		for _, key := range unionKeys(base, data) {
+			if !rawEqual(base[key], data[key]) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	var firstErr error
+	for _, key := range keys {
+		hash := hashKey(key)
+		e, ok := s.shardFor(hash).load().Get(key, hash)
+		var current json.RawMessage
+		if ok {
+			current = e.value
+		}
+		version := AnyVersion
+		if policy == ReloadMerge {
+			if !rawEqual(current, base[key]) {
+				continue
+			}
+			// the key may be changed while it is applied.
+			version = versionOf(e, ok)
+		}
+		value, found := data[key]
+		if !found {
+			s.remove(key, EventDelete, version)
+			continue
+		}
+		// compare the stored values, which may have encrypted fields.
+		if ok && bytes.Equal(e.value, value) {
+			continue
+		}
+		// the read-only stores are also reloaded.
+		_, err := s.write(s.getConfig(), key, value, version)
+		if err != nil && err != ErrVersionMismatch && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,217 @@
+package jsonstore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHotReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "foo.jsonstore")
+	ioutil.WriteFile(filename, []byte(`{"same":1,"changed":1,"deleted":1}`), 0644)
+
+	for _, policy := range []ReloadPolicy{ReloadMerge, ReloadReplace} {
+		ks, err := Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ks.Set("local", 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		events := ks.Watch(ctx, "")
+		if err := ks.StartHotReload(filename, HotReloadOptions{Interval: 10 * time.Millisecond, Policy: policy}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.StartHotReload(filename, HotReloadOptions{}); err == nil {
+			t.Error("want error, got nil")
+		}
+
+		other := newStoreFromJSON(t, `{"same":1,"changed":2,"added":1}`)
+		if err := SaveAndRename(other, filename); err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]EventType{"changed": EventSet, "deleted": EventDelete, "added": EventSet}
+		if policy == ReloadReplace {
+			want["local"] = EventDelete
+		}
+		got := map[string]EventType{}
+		timeout := time.After(5 * time.Second)
+		for len(got) < len(want) {
+			select {
+			case ev := <-events:
+				got[ev.Key] = ev.Type
+			case <-timeout:
+				t.Fatalf("%d: timeout: %v", policy, got)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: want %v, got %v", policy, want, got)
+		}
+
+		wantData := map[string]string{"same": "1", "changed": "2", "added": "1"}
+		if policy == ReloadMerge {
+			wantData["local"] = "1"
+		}
+		if got := storeData(ks); !reflect.DeepEqual(got, wantData) {
+			t.Errorf("%d: want %v, got %v", policy, wantData, got)
+		}
+
+		ks.StopHotReload()
+		ks.StopHotReload()
+		cancel()
+		ioutil.WriteFile(filename, []byte(`{"same":1,"changed":1,"deleted":1}`), 0644)
+	}
+}
+
+func TestHotReload_Error(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "foo.jsonstore")
+	ioutil.WriteFile(filename, []byte(`{"a":1}`), 0644)
+
+	ks, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	err = ks.StartHotReload(filename, HotReloadOptions{
+		Interval: 10 * time.Millisecond,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ks.StopHotReload()
+
+	ioutil.WriteFile(filename, []byte(`{"a":2,"b":`), 0644)
+	select {
+	case err := <-errs:
+		if _, ok := err.(*CorruptionError); !ok {
+			t.Errorf("want *CorruptionError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	if got, want := storeData(ks), map[string]string{"a": "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestHotReload_Options(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "foo.jsonstore")
+
+	// the file is gzipped and encrypted, but the name doesn't say so.
+	opts := Options{Create: true, Format: FormatGzip, Keys: []*Key{newTestKey(t, 1)}}
+	ks, err := OpenFile(filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	err = ks.StartHotReload(filename, HotReloadOptions{
+		Interval: 10 * time.Millisecond,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ks.StopHotReload()
+
+	other, err := OpenFile(filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Set("hello", "world")
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for ks.Size() == 0 {
+		select {
+		case err := <-errs:
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatal("timeout")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	var v string
+	if err := ks.Get("hello", &v); err != nil || v != "world" {
+		t.Errorf("want %q, got %q, %v", "world", v, err)
+	}
+}
+
+func TestHotReload_Save(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "foo.jsonstore")
+	ioutil.WriteFile(filename, []byte(`{"k":0,"x":0}`), 0644)
+
+	ks, err := OpenFile(filename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.StartHotReload(filename, HotReloadOptions{Interval: 10 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	defer ks.StopHotReload()
+
+	// the saves of the store are not reloaded.
+	ks.Set("k", 1)
+	if err := ks.Save(); err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("k", 2)
+	time.Sleep(100 * time.Millisecond)
+	if got, want := storeData(ks), map[string]string{"k": "2", "x": "0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// the keys changed in the store since the save are kept.
+	ks.Set("x", 1)
+	if err := SaveAndRename(newStoreFromJSON(t, `{"k":1,"x":2,"y":1}`), filename); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for ks.Size() < 3 {
+		select {
+		case <-timeout:
+			t.Fatal("timeout")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if got, want := storeData(ks), map[string]string{"k": "2", "x": "1", "y": "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,931 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON Schema.
+//
+// Schema supports a subset of JSON Schema draft 2020-12:
+// type, enum, const, properties, patternProperties, additionalProperties, required,
+// minProperties, maxProperties, items, prefixItems, minItems, maxItems, uniqueItems,
+// minLength, maxLength, pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// multipleOf, allOf, anyOf, oneOf, not, $defs and local $ref (e.g. "#/$defs/name").
+// Other keywords are ignored. pattern uses the syntax of the regexp package.
+type Schema struct {
+	root *schemaNode
+}
+
+type schemaNode struct {
+	// boolean schema
+	isBool bool
+	value  bool
+
+	types    []string
+	enum     []interface{}
+	hasEnum  bool
+	constVal interface{}
+	hasConst bool
+
+	properties           map[string]*schemaNode
+	patternProperties    []patternSchema
+	additionalProperties *schemaNode
+	required             []string
+	minProperties        int
+	maxProperties        int
+
+	prefixItems []*schemaNode
+	items       *schemaNode
+	minItems    int
+	maxItems    int
+	uniqueItems bool
+
+	minLength int
+	maxLength int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *big.Rat
+
+	allOf []*schemaNode
+	anyOf []*schemaNode
+	oneOf []*schemaNode
+	not   *schemaNode
+
+	ref     string
+	refNode *schemaNode
+}
+
+type patternSchema struct {
+	re   *regexp.Regexp
+	node *schemaNode
+}
+
+// SchemaViolation is a violation of a JSON Schema.
+type SchemaViolation struct {
+	// Path is the JSON Pointer to the invalid part of the value.
+	Path string
+
+	// Message describes the violation.
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	p := v.Path
+	if p == "" {
+		p = "/"
+	}
+	return p + ": " + v.Message
+}
+
+// ValidationError is returned when a value does not match the registered schemas.
+type ValidationError struct {
+	Key        string
+	Violations []SchemaViolation
+}
+
+func (err *ValidationError) Error() string {
+	var buf strings.Builder
+	buf.WriteString("jsonstore: invalid value for key \"")
+	buf.WriteString(err.Key)
+	buf.WriteString("\": ")
+	for i, v := range err.Violations {
+		if i > 0 {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(v.String())
+	}
+	return buf.String()
+}
+
+// ValidationErrors is a list of ValidationError returned by JSONStore.Validate.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", errs[0].Error(), len(errs)-1)
+}
+
+// CompileSchema parses a JSON Schema.
+func CompileSchema(data []byte) (*Schema, error) {
+	doc, err := decodeUseNumber(data)
+	if err != nil {
+		return nil, err
+	}
+	c := &schemaCompiler{
+		doc:   doc,
+		nodes: make(map[string]*schemaNode),
+	}
+	root, err := c.compile(doc, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.resolve(); err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+// MustCompileSchema is like CompileSchema but panics if the schema cannot be parsed.
+func MustCompileSchema(data []byte) *Schema {
+	s, err := CompileSchema(data)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Validate validates a JSON value.
+// It returns nil if the value is valid, or the list of violations.
+func (s *Schema) Validate(value json.RawMessage) []SchemaViolation {
+	v, err := decodeUseNumber(value)
+	if err != nil {
+		return []SchemaViolation{{Message: err.Error()}}
+	}
+	var violations []SchemaViolation
+	s.root.validate(v, "", &violations)
+	return violations
+}
+
+type schemaCompiler struct {
+	doc   interface{}
+	nodes map[string]*schemaNode
+	refs  []*schemaNode
+}
+
+func (c *schemaCompiler) compile(v interface{}, ptr string) (*schemaNode, error) {
+	if n, ok := c.nodes[ptr]; ok {
+		return n, nil
+	}
+	n := &schemaNode{
+		minProperties: -1,
+		maxProperties: -1,
+		minItems:      -1,
+		maxItems:      -1,
+		minLength:     -1,
+		maxLength:     -1,
+	}
+	c.nodes[ptr] = n
+
+	switch v := v.(type) {
+	case bool:
+		n.isBool = true
+		n.value = v
+		return n, nil
+	case map[string]interface{}:
+		if err := c.compileObject(n, v, ptr); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	return nil, schemaError(ptr, "schema must be an object or a boolean")
+}
+
+func (c *schemaCompiler) compileObject(n *schemaNode, obj map[string]interface{}, ptr string) error {
+	var err error
+
+	if t, ok := obj["type"]; ok {
+		switch t := t.(type) {
+		case string:
+			n.types = []string{t}
+		case []interface{}:
+			for _, s := range t {
+				s, ok := s.(string)
+				if !ok {
+					return schemaError(ptr+"/type", "type must be a string or an array of strings")
+				}
+				n.types = append(n.types, s)
+			}
+		default:
+			return schemaError(ptr+"/type", "type must be a string or an array of strings")
+		}
+		for _, t := range n.types {
+			switch t {
+			case "null", "boolean", "object", "array", "number", "integer", "string":
+			default:
+				return schemaError(ptr+"/type", "unknown type "+strconv.Quote(t))
+			}
+		}
+	}
+	if e, ok := obj["enum"]; ok {
+		arr, ok := e.([]interface{})
+		if !ok {
+			return schemaError(ptr+"/enum", "enum must be an array")
+		}
+		n.enum = arr
+		n.hasEnum = true
+	}
+	if v, ok := obj["const"]; ok {
+		n.constVal = v
+		n.hasConst = true
+	}
+
+	// objects
+	if props, ok := obj["properties"]; ok {
+		m, ok := props.(map[string]interface{})
+		if !ok {
+			return schemaError(ptr+"/properties", "properties must be an object")
+		}
+		n.properties = make(map[string]*schemaNode, len(m))
+		for name, sub := range m {
+			n.properties[name], err = c.compile(sub, ptr+"/properties/"+escapePointer(name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if props, ok := obj["patternProperties"]; ok {
+		m, ok := props.(map[string]interface{})
+		if !ok {
+			return schemaError(ptr+"/patternProperties", "patternProperties must be an object")
+		}
+		patterns := make([]string, 0, len(m))
+		for pattern := range m {
+			patterns = append(patterns, pattern)
+		}
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			subptr := ptr + "/patternProperties/" + escapePointer(pattern)
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return schemaError(subptr, err.Error())
+			}
+			node, err := c.compile(m[pattern], subptr)
+			if err != nil {
+				return err
+			}
+			n.patternProperties = append(n.patternProperties, patternSchema{re: re, node: node})
+		}
+	}
+	if sub, ok := obj["additionalProperties"]; ok {
+		if n.additionalProperties, err = c.compile(sub, ptr+"/additionalProperties"); err != nil {
+			return err
+		}
+	}
+	if req, ok := obj["required"]; ok {
+		arr, ok := req.([]interface{})
+		if !ok {
+			return schemaError(ptr+"/required", "required must be an array of strings")
+		}
+		for _, name := range arr {
+			name, ok := name.(string)
+			if !ok {
+				return schemaError(ptr+"/required", "required must be an array of strings")
+			}
+			n.required = append(n.required, name)
+		}
+	}
+	if n.minProperties, err = schemaInt(obj, "minProperties", ptr); err != nil {
+		return err
+	}
+	if n.maxProperties, err = schemaInt(obj, "maxProperties", ptr); err != nil {
+		return err
+	}
+
+	// arrays
+	if items, ok := obj["prefixItems"]; ok {
+		arr, ok := items.([]interface{})
+		if !ok {
+			return schemaError(ptr+"/prefixItems", "prefixItems must be an array")
+		}
+		for i, sub := range arr {
+			node, err := c.compile(sub, ptr+"/prefixItems/"+strconv.Itoa(i))
+			if err != nil {
+				return err
+			}
+			n.prefixItems = append(n.prefixItems, node)
+		}
+	}
+	if sub, ok := obj["items"]; ok {
+		if n.items, err = c.compile(sub, ptr+"/items"); err != nil {
+			return err
+		}
+	}
+	if n.minItems, err = schemaInt(obj, "minItems", ptr); err != nil {
+		return err
+	}
+	if n.maxItems, err = schemaInt(obj, "maxItems", ptr); err != nil {
+		return err
+	}
+	if u, ok := obj["uniqueItems"]; ok {
+		b, ok := u.(bool)
+		if !ok {
+			return schemaError(ptr+"/uniqueItems", "uniqueItems must be a boolean")
+		}
+		n.uniqueItems = b
+	}
+
+	// strings
+	if n.minLength, err = schemaInt(obj, "minLength", ptr); err != nil {
+		return err
+	}
+	if n.maxLength, err = schemaInt(obj, "maxLength", ptr); err != nil {
+		return err
+	}
+	if p, ok := obj["pattern"]; ok {
+		s, ok := p.(string)
+		if !ok {
+			return schemaError(ptr+"/pattern", "pattern must be a string")
+		}
+		if n.pattern, err = regexp.Compile(s); err != nil {
+			return schemaError(ptr+"/pattern", err.Error())
+		}
+	}
+
+	// numbers
+	for _, kw := range []struct {
+		name string
+		dst  **float64
+	}{
+		{"minimum", &n.minimum},
+		{"maximum", &n.maximum},
+		{"exclusiveMinimum", &n.exclusiveMinimum},
+		{"exclusiveMaximum", &n.exclusiveMaximum},
+	} {
+		v, ok := obj[kw.name]
+		if !ok {
+			continue
+		}
+		num, ok := v.(json.Number)
+		if !ok {
+			return schemaError(ptr+"/"+kw.name, kw.name+" must be a number")
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return schemaError(ptr+"/"+kw.name, err.Error())
+		}
+		*kw.dst = &f
+	}
+	if v, ok := obj["multipleOf"]; ok {
+		num, ok := v.(json.Number)
+		if !ok {
+			return schemaError(ptr+"/multipleOf", "multipleOf must be a number")
+		}
+		r, ok := new(big.Rat).SetString(num.String())
+		if !ok || r.Sign() <= 0 {
+			return schemaError(ptr+"/multipleOf", "multipleOf must be greater than 0")
+		}
+		n.multipleOf = r
+	}
+
+	// combinators
+	for _, kw := range []struct {
+		name string
+		dst  *[]*schemaNode
+	}{
+		{"allOf", &n.allOf},
+		{"anyOf", &n.anyOf},
+		{"oneOf", &n.oneOf},
+	} {
+		v, ok := obj[kw.name]
+		if !ok {
+			continue
+		}
+		arr, ok := v.([]interface{})
+		if !ok || len(arr) == 0 {
+			return schemaError(ptr+"/"+kw.name, kw.name+" must be a non-empty array")
+		}
+		for i, sub := range arr {
+			node, err := c.compile(sub, ptr+"/"+kw.name+"/"+strconv.Itoa(i))
+			if err != nil {
+				return err
+			}
+			*kw.dst = append(*kw.dst, node)
+		}
+	}
+	if sub, ok := obj["not"]; ok {
+		if n.not, err = c.compile(sub, ptr+"/not"); err != nil {
+			return err
+		}
+	}
+
+	// definitions are compiled when they are referenced.
+	if ref, ok := obj["$ref"]; ok {
+		s, ok := ref.(string)
+		if !ok {
+			return schemaError(ptr+"/$ref", "$ref must be a string")
+		}
+		if s != "#" && !strings.HasPrefix(s, "#/") {
+			return schemaError(ptr+"/$ref", "only local references are supported")
+		}
+		n.ref = strings.TrimPrefix(s, "#")
+		c.refs = append(c.refs, n)
+	}
+	return nil
+}
+
+// resolve resolves $ref.
+func (c *schemaCompiler) resolve() error {
+	for i := 0; i < len(c.refs); i++ {
+		n := c.refs[i]
+		target, ok := lookupPointer(c.doc, n.ref)
+		if !ok {
+			return schemaError(n.ref, "$ref target not found")
+		}
+		node, err := c.compile(target, n.ref)
+		if err != nil {
+			return err
+		}
+		n.refNode = node
+	}
+	done := make(map[*schemaNode]bool)
+	for _, n := range c.refs {
+		if err := checkCycle(n, n.ref, make(map[*schemaNode]bool), done); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCycle reports an error if n applies itself to the same value through $ref,
+// allOf, anyOf, oneOf or not, because the validation never ends.
+// ptr is the last $ref on the way to n.
+func checkCycle(n *schemaNode, ptr string, path, done map[*schemaNode]bool) error {
+	if done[n] {
+		return nil
+	}
+	if path[n] {
+		return schemaError(ptr, "$ref cycle")
+	}
+	path[n] = true
+	if n.refNode != nil {
+		if err := checkCycle(n.refNode, n.ref, path, done); err != nil {
+			return err
+		}
+	}
+	subs := append(append(append([]*schemaNode{}, n.allOf...), n.anyOf...), n.oneOf...)
+	if n.not != nil {
+		subs = append(subs, n.not)
+	}
+	for _, sub := range subs {
+		if err := checkCycle(sub, ptr, path, done); err != nil {
+			return err
+		}
+	}
+	delete(path, n)
+	done[n] = true
+	return nil
+}
+
+func schemaInt(obj map[string]interface{}, name, ptr string) (int, error) {
+	v, ok := obj[name]
+	if !ok {
+		return -1, nil
+	}
+	num, ok := v.(json.Number)
+	if !ok {
+		return 0, schemaError(ptr+"/"+name, name+" must be a non-negative integer")
+	}
+	i, err := strconv.Atoi(num.String())
+	if err != nil || i < 0 {
+		return 0, schemaError(ptr+"/"+name, name+" must be a non-negative integer")
+	}
+	return i, nil
+}
+
+func schemaError(ptr, msg string) error {
+	if ptr == "" {
+		ptr = "/"
+	}
+	return errors.New("jsonstore: invalid schema at " + ptr + ": " + msg)
+}
+
+func (n *schemaNode) validate(v interface{}, ptr string, violations *[]SchemaViolation) {
+	add := func(format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{Path: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if n.isBool {
+		if !n.value {
+			add("no value is allowed")
+		}
+		return
+	}
+	if n.refNode != nil {
+		n.refNode.validate(v, ptr, violations)
+	}
+
+	if len(n.types) > 0 {
+		ok := false
+		for _, t := range n.types {
+			if matchType(v, t) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			add("expected %s, got %s", strings.Join(n.types, " or "), typeOf(v))
+			return
+		}
+	}
+	if n.hasEnum {
+		ok := false
+		for _, e := range n.enum {
+			if jsonEqual(v, e) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			add("value is not one of the enum values")
+		}
+	}
+	if n.hasConst && !jsonEqual(v, n.constVal) {
+		add("value does not match const")
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		n.validateObject(v, ptr, violations)
+	case []interface{}:
+		n.validateArray(v, ptr, violations)
+	case string:
+		l := utf8.RuneCountInString(v)
+		if n.minLength >= 0 && l < n.minLength {
+			add("string is shorter than %d", n.minLength)
+		}
+		if n.maxLength >= 0 && l > n.maxLength {
+			add("string is longer than %d", n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			add("string does not match pattern %q", n.pattern.String())
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if n.minimum != nil && f < *n.minimum {
+			add("%s is less than minimum %v", v, *n.minimum)
+		}
+		if n.maximum != nil && f > *n.maximum {
+			add("%s is greater than maximum %v", v, *n.maximum)
+		}
+		if n.exclusiveMinimum != nil && f <= *n.exclusiveMinimum {
+			add("%s is less than or equal to exclusiveMinimum %v", v, *n.exclusiveMinimum)
+		}
+		if n.exclusiveMaximum != nil && f >= *n.exclusiveMaximum {
+			add("%s is greater than or equal to exclusiveMaximum %v", v, *n.exclusiveMaximum)
+		}
+		if n.multipleOf != nil {
+			r, ok := new(big.Rat).SetString(v.String())
+			if !ok || !new(big.Rat).Quo(r, n.multipleOf).IsInt() {
+				add("%s is not a multiple of %s", v, n.multipleOf.RatString())
+			}
+		}
+	}
+
+	for _, sub := range n.allOf {
+		sub.validate(v, ptr, violations)
+	}
+	if len(n.anyOf) > 0 {
+		ok := false
+		for _, sub := range n.anyOf {
+			if sub.valid(v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			add("value does not match any schema in anyOf")
+		}
+	}
+	if len(n.oneOf) > 0 {
+		count := 0
+		for _, sub := range n.oneOf {
+			if sub.valid(v) {
+				count++
+			}
+		}
+		if count != 1 {
+			add("value matches %d schemas in oneOf, expected exactly 1", count)
+		}
+	}
+	if n.not != nil && n.not.valid(v) {
+		add("value must not match the schema in not")
+	}
+}
+
+func (n *schemaNode) validateObject(obj map[string]interface{}, ptr string, violations *[]SchemaViolation) {
+	add := func(format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{Path: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, name := range n.required {
+		if _, ok := obj[name]; !ok {
+			add("missing required property %q", name)
+		}
+	}
+	if n.minProperties >= 0 && len(obj) < n.minProperties {
+		add("object has fewer than %d properties", n.minProperties)
+	}
+	if n.maxProperties >= 0 && len(obj) > n.maxProperties {
+		add("object has more than %d properties", n.maxProperties)
+	}
+
+	// validate in a stable order
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		subptr := ptr + "/" + escapePointer(name)
+		matched := false
+		if sub, ok := n.properties[name]; ok {
+			matched = true
+			sub.validate(obj[name], subptr, violations)
+		}
+		for _, p := range n.patternProperties {
+			if p.re.MatchString(name) {
+				matched = true
+				p.node.validate(obj[name], subptr, violations)
+			}
+		}
+		if !matched && n.additionalProperties != nil {
+			if n.additionalProperties.isBool && !n.additionalProperties.value {
+				add("additional property %q is not allowed", name)
+				continue
+			}
+			n.additionalProperties.validate(obj[name], subptr, violations)
+		}
+	}
+}
+
+func (n *schemaNode) validateArray(arr []interface{}, ptr string, violations *[]SchemaViolation) {
+	add := func(format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{Path: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if n.minItems >= 0 && len(arr) < n.minItems {
+		add("array has fewer than %d items", n.minItems)
+	}
+	if n.maxItems >= 0 && len(arr) > n.maxItems {
+		add("array has more than %d items", n.maxItems)
+	}
+	if n.uniqueItems {
+	UNIQUE:
+		for i := range arr {
+			for j := 0; j < i; j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					add("items %d and %d are equal", j, i)
+					break UNIQUE
+				}
+			}
+		}
+	}
+	for i, item := range arr {
+		subptr := ptr + "/" + strconv.Itoa(i)
+		if i < len(n.prefixItems) {
+			n.prefixItems[i].validate(item, subptr, violations)
+		} else if n.items != nil {
+			n.items.validate(item, subptr, violations)
+		}
+	}
+}
+
+func (n *schemaNode) valid(v interface{}) bool {
+	var violations []SchemaViolation
+	n.validate(v, "", &violations)
+	return len(violations) == 0
+}
+
+func matchType(v interface{}, t string) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case map[string]interface{}:
+		return t == "object"
+	case []interface{}:
+		return t == "array"
+	case string:
+		return t == "string"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		if t == "integer" {
+			f, ok := new(big.Float).SetString(v.String())
+			return ok && f.IsInt()
+		}
+	}
+	return false
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// jsonEqual reports whether a and b are the same JSON value.
+// Numbers are compared by their values.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if a == b {
+			return true
+		}
+		ra, ok1 := new(big.Rat).SetString(a.String())
+		rb, ok2 := new(big.Rat).SetString(b.String())
+		if ok1 && ok2 {
+			return ra.Cmp(rb) == 0
+		}
+		fa, _ := a.Float64()
+		fb, _ := b.Float64()
+		return fa == fb && !math.IsNaN(fa)
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, va := range a {
+			vb, ok := b[k]
+			if !ok || !jsonEqual(va, vb) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func decodeUseNumber(data []byte) (interface{}, error) {
+	if !json.Valid(data) {
+		return nil, ErrInvalidJSON
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// escapePointer escapes a reference token of JSON Pointer (RFC 6901).
+func escapePointer(s string) string {
+	s = strings.Replace(s, "~", "~0", -1)
+	return strings.Replace(s, "/", "~1", -1)
+}
+
+func unescapePointer(s string) string {
+	s = strings.Replace(s, "~1", "/", -1)
+	return strings.Replace(s, "~0", "~", -1)
+}
+
+// lookupPointer returns the value referenced by the JSON Pointer ptr.
+func lookupPointer(v interface{}, ptr string) (interface{}, bool) {
+	if ptr == "" {
+		return v, true
+	}
+	if ptr[0] != '/' {
+		return nil, false
+	}
+	for _, token := range strings.Split(ptr[1:], "/") {
+		token = unescapePointer(token)
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = vv[token]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(vv) {
+				return nil, false
+			}
+			v = vv[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+type schemaEntry struct {
+	pattern string
+	prefix  bool
+	schema  *Schema
+}
+
+func (e schemaEntry) match(key string) bool {
+	if e.prefix {
+		return strings.HasPrefix(key, e.pattern)
+	}
+	ok, _ := path.Match(e.pattern, key)
+	return ok
+}
+
+// RegisterSchema registers a schema for the keys matching pattern.
+// The pattern syntax is the same as path.Match.
+// Set and other writing methods reject values that do not match all the schemas
+// registered for the key with *ValidationError.
+func (s *JSONStore) RegisterSchema(pattern string, schema *Schema) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+	s.addSchema(schemaEntry{pattern: pattern, schema: schema})
+	return nil
+}
+
+// RegisterSchemaPrefix registers a schema for the keys which have the prefix.
+func (s *JSONStore) RegisterSchemaPrefix(prefix string, schema *Schema) {
+	s.addSchema(schemaEntry{pattern: prefix, prefix: true, schema: schema})
+}
+
+func (s *JSONStore) addSchema(e schemaEntry) {
+	s.updateConfig(func(c *config) {
+		schemas := make([]schemaEntry, 0, len(c.schemas)+1)
+		schemas = append(schemas, c.schemas...)
+		c.schemas = append(schemas, e)
+	})
+}
+
+// Validate validates all values in the store against the registered schemas.
+// It is useful for checking a file loaded by Open.
+// The error is ValidationErrors if some values are invalid.
+func (s *JSONStore) Validate() error {
+	schemas := s.getConfig().schemas
+	data := s.snapshot(false).plainData()
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs ValidationErrors
+	for _, k := range keys {
+		if err := validateValue(schemas, k, data[k]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateValue(schemas []schemaEntry, key string, value []byte) *ValidationError {
+	var violations []SchemaViolation
+	for _, e := range schemas {
+		if e.match(key) {
+			violations = append(violations, e.schema.Validate(value)...)
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Key: key, Violations: violations}
+}
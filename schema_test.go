@@ -0,0 +1,183 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+const humanSchema = `{
+	"type": "object",
+	"properties": {
+		"Name": {"type": "string", "minLength": 1},
+		"Height": {"type": "number", "exclusiveMinimum": 0},
+		"Tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "uniqueItems": true}
+	},
+	"required": ["Name", "Height"],
+	"additionalProperties": false,
+	"$defs": {
+		"tag": {"type": "string", "pattern": "^[a-z]+$"}
+	}
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	schema := MustCompileSchema([]byte(humanSchema))
+
+	tests := []struct {
+		in   string
+		want []SchemaViolation
+	}{
+		{`{"Name":"Dante","Height":5.4}`, nil},
+		{`{"Name":"Dante","Height":5.4,"Tags":["poet"]}`, nil},
+		{`[]`, []SchemaViolation{{"", "expected object, got array"}}},
+		{`{"Name":""}`, []SchemaViolation{
+			{"", `missing required property "Height"`},
+			{"/Name", "string is shorter than 1"},
+		}},
+		{`{"Name":"Dante","Height":0,"Age":30}`, []SchemaViolation{
+			{"", `additional property "Age" is not allowed`},
+			{"/Height", "0 is less than or equal to exclusiveMinimum 0"},
+		}},
+		{`{"Name":"Dante","Height":5.4,"Tags":["poet","Poet","poet"]}`, []SchemaViolation{
+			{"/Tags", "items 0 and 2 are equal"},
+			{"/Tags/1", `string does not match pattern "^[a-z]+$"`},
+		}},
+	}
+	for _, tt := range tests {
+		got := schema.Validate(json.RawMessage(tt.in))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: want %v, got %v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestSchemaKeywords(t *testing.T) {
+	tests := []struct {
+		schema  string
+		valid   []string
+		invalid []string
+	}{
+		{`{"type":"integer"}`, []string{`1`, `1.0`, `-3`}, []string{`1.5`, `"1"`}},
+		{`{"type":["string","null"]}`, []string{`"a"`, `null`}, []string{`1`}},
+		{`{"enum":[1,"a",{"b":[true]}]}`, []string{`1.0`, `"a"`, `{"b":[true]}`}, []string{`2`, `{"b":[false]}`}},
+		{`{"const":{"a":1}}`, []string{`{"a":1}`}, []string{`{"a":2}`}},
+		{`{"multipleOf":0.1}`, []string{`0.3`, `2`}, []string{`0.35`}},
+		{`{"minimum":1,"maximum":3}`, []string{`1`, `3`}, []string{`0.9`, `3.1`}},
+		{`{"maxLength":2}`, []string{`"日本"`}, []string{`"日本語"`}},
+		{`{"prefixItems":[{"type":"string"}],"items":{"type":"number"},"minItems":1,"maxItems":3}`,
+			[]string{`["a"]`, `["a",1,2]`}, []string{`[]`, `[1]`, `["a","b"]`, `["a",1,2,3]`}},
+		{`{"patternProperties":{"^x-":{"type":"string"}},"additionalProperties":{"type":"number"}}`,
+			[]string{`{"x-a":"a","b":1}`}, []string{`{"x-a":1}`, `{"b":"b"}`}},
+		{`{"minProperties":1,"maxProperties":1}`, []string{`{"a":1}`}, []string{`{}`, `{"a":1,"b":2}`}},
+		{`{"allOf":[{"minimum":1},{"maximum":2}]}`, []string{`1`}, []string{`3`}},
+		{`{"anyOf":[{"type":"string"},{"type":"number"}]}`, []string{`1`, `"a"`}, []string{`null`}},
+		{`{"oneOf":[{"type":"integer"},{"minimum":2}]}`, []string{`1`, `2.5`}, []string{`3`}},
+		{`{"not":{"type":"null"}}`, []string{`1`}, []string{`null`}},
+		{`false`, nil, []string{`1`}},
+		{`{"type":"object","properties":{"next":{"$ref":"#"}},"additionalProperties":false}`,
+			[]string{`{"next":{"next":{}}}`}, []string{`{"next":{"prev":{}}}`}},
+	}
+	for _, tt := range tests {
+		schema, err := CompileSchema([]byte(tt.schema))
+		if err != nil {
+			t.Errorf("%s: %v", tt.schema, err)
+			continue
+		}
+		for _, v := range tt.valid {
+			if violations := schema.Validate(json.RawMessage(v)); len(violations) != 0 {
+				t.Errorf("%s: %s must be valid, got %v", tt.schema, v, violations)
+			}
+		}
+		for _, v := range tt.invalid {
+			if violations := schema.Validate(json.RawMessage(v)); len(violations) == 0 {
+				t.Errorf("%s: %s must be invalid", tt.schema, v)
+			}
+		}
+	}
+}
+
+func TestCompileSchemaError(t *testing.T) {
+	for _, in := range []string{
+		`1`,
+		`{"type":"float"}`,
+		`{"required":"Name"}`,
+		`{"pattern":"("}`,
+		`{"minLength":-1}`,
+		`{"multipleOf":0}`,
+		`{"$ref":"#/$defs/missing"}`,
+		`{"$ref":"http://example.com/schema"}`,
+		`{"properties":{"a":1}}`,
+		`{"$ref":"#"}`,
+		`{"$defs":{"a":{"$ref":"#/$defs/a"}},"$ref":"#/$defs/a"}`,
+		`{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"allOf":[{"$ref":"#/$defs/a"}]}},"$ref":"#/$defs/a"}`,
+	} {
+		if _, err := CompileSchema([]byte(in)); err == nil {
+			t.Errorf("%s: want error, got nil", in)
+		}
+	}
+}
+
+func TestRegisterSchema(t *testing.T) {
+	ks := new(JSONStore)
+	if err := ks.RegisterSchema("human:*", MustCompileSchema([]byte(humanSchema))); err != nil {
+		t.Fatal(err)
+	}
+	ks.RegisterSchemaPrefix("count/", MustCompileSchema([]byte(`{"type":"integer"}`)))
+	if err := ks.RegisterSchema("[", MustCompileSchema([]byte(`true`))); err == nil {
+		t.Error("want error, got nil")
+	}
+
+	if err := ks.Set("human:1", Human{"Dante", 5.4}); err != nil {
+		t.Fatal(err)
+	}
+	err := ks.Set("human:2", Human{"", 5.4})
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("want *ValidationError, got %v", err)
+	}
+	if verr.Key != "human:2" || len(verr.Violations) != 1 || verr.Violations[0].Path != "/Name" {
+		t.Errorf("unexpected error: %v", verr)
+	}
+	if _, err := ks.GetRaw("human:2"); err == nil {
+		t.Error("invalid value must not be stored")
+	}
+
+	if err := ks.SetRaw("count/a", json.RawMessage(`1.5`)); err == nil {
+		t.Error("want error, got nil")
+	}
+	if err := ks.SetRawCanonical("count/a", json.RawMessage(`2`)); err != nil {
+		t.Error(err)
+	}
+	if err := ks.Set("other", "anything"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	f, err := ioutil.TempFile("", "jsonstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	ioutil.WriteFile(f.Name(), []byte(`{"human:1":{"Name":"Dante","Height":5.4},"human:2":{"Name":1,"Height":5.4},"human:3":{}}`), 0644)
+
+	ks, err := Open(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Validate(); err != nil {
+		t.Errorf("no schema is registered, got %v", err)
+	}
+
+	ks.RegisterSchemaPrefix("human:", MustCompileSchema([]byte(humanSchema)))
+	err = ks.Validate()
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("want ValidationErrors, got %v", err)
+	}
+	if len(errs) != 2 || errs[0].Key != "human:2" || errs[1].Key != "human:3" {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
@@ -0,0 +1,73 @@
+package jsonstore
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// shardCount is the number of shards of a JSONStore. It must be a power of two.
+const shardCount = 1 << hamtShift
+
+// shard is a part of a JSONStore.
+// Each key belongs to the shard chosen by the hash of the key.
+//
+// The data of a shard is an immutable trie published atomically,
+// so readers never lock. Writers lock mu, build a new version of the trie, and publish it.
+type shard struct {
+	mu   sync.Mutex
+	tree atomic.Value // *hamt
+}
+
+// shardIndex returns the index of the shard for the hash of a key.
+func shardIndex(hash uint64) int {
+	return int(hash & (shardCount - 1))
+}
+
+func (s *JSONStore) shardFor(hash uint64) *shard {
+	return &s.shards[shardIndex(hash)]
+}
+
+// load returns the current version of the data.
+func (sh *shard) load() *hamt {
+	t, _ := sh.tree.Load().(*hamt)
+	return t
+}
+
+// lockAll locks all the shards, which stops the writers.
+// Shards are always locked in the same order to avoid deadlocks.
+func (s *JSONStore) lockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+	}
+}
+
+func (s *JSONStore) unlockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.Unlock()
+	}
+}
+
+// loadTrees returns the current versions of all the shards without locking them.
+// The shards are loaded one by one, so the writes during the call may be seen partially.
+// Use trees for a consistent snapshot.
+func (s *JSONStore) loadTrees() [shardCount]*hamt {
+	var trees [shardCount]*hamt
+	for i := range s.shards {
+		trees[i] = s.shards[i].load()
+	}
+	return trees
+}
+
+// trees returns the current versions of all the shards and the count of changes at the moment.
+// It stops the writers only while it loads the pointers, so it is O(1) to the size of the store.
+// The saves and the views use it, so that the count matches the data.
+func (s *JSONStore) trees() ([shardCount]*hamt, int64) {
+	var trees [shardCount]*hamt
+	s.lockAll()
+	for i := range s.shards {
+		trees[i] = s.shards[i].load()
+	}
+	setCount := atomic.LoadInt64(&s.setCount)
+	s.unlockAll()
+	return trees, setCount
+}
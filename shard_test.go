@@ -0,0 +1,131 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSnapshotConsistency(t *testing.T) {
+	ks := new(JSONStore)
+
+	var wg sync.WaitGroup
+	var stop int32
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; atomic.LoadInt32(&stop) == 0; j++ {
+				ks.Set(strconv.Itoa(i)+"-"+strconv.Itoa(j), j)
+			}
+		}(i)
+	}
+
+	// every Set adds a new key, so the number of keys must match the count of changes.
+	for i := 0; i < 100; i++ {
+		snapshot := ks.snapshot(false)
+		if int64(snapshot.len()) != snapshot.setCount {
+			t.Errorf("inconsistent snapshot: %d keys, %d changes", snapshot.len(), snapshot.setCount)
+		}
+		all := ks.GetAll(nil)
+		if int64(all.Size()) != all.setCount {
+			t.Errorf("inconsistent GetAll: %d keys, %d changes", all.Size(), all.setCount)
+		}
+	}
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+
+	if len(ks.Keys()) != ks.Size() {
+		t.Errorf("Keys and Size mismatch: %d, %d", len(ks.Keys()), ks.Size())
+	}
+}
+
+func TestShardIndex(t *testing.T) {
+	var counts [shardCount]int
+	for i := 0; i < 10000; i++ {
+		counts[shardIndex(hashKey(key(i)))]++
+	}
+	for i, c := range counts {
+		if c == 0 {
+			t.Errorf("shard %d is empty", i)
+		}
+	}
+}
+
+// BenchmarkParaSetKeys measures parallel writers updating different keys.
+// Run with -cpu 1,2,4,8 to see how it scales.
+func BenchmarkParaSetKeys(b *testing.B) {
+	ks := new(JSONStore)
+	var id int32
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		prefix := strconv.Itoa(int(atomic.AddInt32(&id, 1))) + ":"
+		i := 0
+		for pb.Next() {
+			err := ks.Set(prefix+strconv.Itoa(i%1000), Human{"Dante", 5.4})
+			if err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+// BenchmarkParaGetSetKeys measures parallel readers and writers with different keys.
+func BenchmarkParaGetSetKeys(b *testing.B) {
+	ks := new(JSONStore)
+	for i := 0; i < 1000; i++ {
+		ks.Set(key(i), Human{"Dante", 5.4})
+	}
+	var id int32
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		n := int(atomic.AddInt32(&id, 1))
+		var human Human
+		for i := 0; pb.Next(); i++ {
+			k := key((n*7919 + i) % 1000)
+			if i%4 == 0 {
+				ks.Set(k, Human{"Dante", 5.4})
+			} else {
+				ks.Get(k, &human)
+			}
+		}
+	})
+}
+
+func BenchmarkSnapshot(b *testing.B) {
+	ks := new(JSONStore)
+	for i := 0; i < 10000; i++ {
+		ks.Set(key(i), Human{"Dante", 5.4})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ks.snapshot(false)
+	}
+}
+
+func TestReadsDontLock(t *testing.T) {
+	ks := new(JSONStore)
+	ks.Set("hello", "world")
+
+	// a writer holds a shard.
+	ks.shards[0].mu.Lock()
+	defer ks.shards[0].mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ks.Size()
+		ks.Keys()
+		ks.Range(func(key string, value json.RawMessage) bool { return true })
+		ks.EvictionStats()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reads wait for the writer")
+	}
+}
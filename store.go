@@ -0,0 +1,39 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrReadOnly is returned when modifying a read-only store.
+var ErrReadOnly = errors.New("jsonstore: read-only store")
+
+// Store is the interface of key-value stores of JSON values.
+// JSONStore and View implement it; use the jsonstoretest package for testing other implementations.
+type Store interface {
+	// Get will return the value associated with a key.
+	// It returns NoSuchKeyError if the key does not exist.
+	Get(key string, v interface{}) error
+
+	// Set saves a value at the given key.
+	// A read-only store returns ErrReadOnly.
+	Set(key string, value interface{}) error
+
+	// Delete removes a key from the store. A read-only store ignores it.
+	Delete(key string)
+
+	// Keys returns all the keys in the store.
+	Keys() []string
+
+	// Size returns the number of keys in the store.
+	Size() int
+
+	// Range calls fn for each key and raw JSON value until fn returns false.
+	// fn MUST NOT modify value.
+	Range(fn func(key string, value json.RawMessage) bool)
+}
+
+var (
+	_ Store = (*JSONStore)(nil)
+	_ Store = (*View)(nil)
+)
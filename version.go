@@ -0,0 +1,71 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// ErrVersionMismatch is returned when the version of a key is not the expected one.
+var ErrVersionMismatch = errors.New("jsonstore: version mismatch")
+
+// AnyVersion matches any version of a key, including a missing key.
+const AnyVersion int64 = -1
+
+// Each write of a key gives it a new version, which is greater than any version
+// given before in the store. A missing key has version 0.
+// Versions are not saved to the file; the keys loaded by Open have version 1.
+
+// versionOf returns the version of the result of hamt.Get.
+func versionOf(e *entry, ok bool) int64 {
+	if !ok {
+		return 0
+	}
+	return e.version
+}
+
+// GetRawVersion returns a copy of the raw JSON value associated with a key, and its version.
+func (s *JSONStore) GetRawVersion(key string) (json.RawMessage, int64, error) {
+	hash := hashKey(key)
+	e, ok := s.shardFor(hash).load().Get(key, hash)
+	if !ok {
+		return nil, 0, NoSuchKeyError{key}
+	}
+	c := s.getConfig()
+	if c.limits.enabled() {
+		e.touch()
+	}
+	value, err := c.decryptFields(key, e.value)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append(json.RawMessage(nil), value...), e.version, nil
+}
+
+// CompareAndSetRaw is like SetRaw, but it saves value only if the current version of key is version.
+// Pass 0 to create a new key, and AnyVersion to save unconditionally.
+// It returns the new version, or ErrVersionMismatch if the version does not match.
+func (s *JSONStore) CompareAndSetRaw(key string, value json.RawMessage, version int64) (int64, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err != nil {
+		return 0, ErrInvalidJSON
+	}
+	return s.setVersion(key, buf.Bytes(), version)
+}
+
+// CompareAndDelete removes key only if its current version is version.
+// It returns ErrVersionMismatch if the version does not match,
+// and NoSuchKeyError if key does not exist.
+func (s *JSONStore) CompareAndDelete(key string, version int64) error {
+	if s.getConfig().readOnly {
+		return ErrReadOnly
+	}
+	old, err := s.remove(key, EventDelete, version)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return NoSuchKeyError{key}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompareAndSetRaw(t *testing.T) {
+	ks := new(JSONStore)
+
+	// 0 creates a new key
+	v1, err := ks.CompareAndSetRaw("hello", json.RawMessage(`"world"`), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.CompareAndSetRaw("hello", json.RawMessage(`"again"`), 0); err != ErrVersionMismatch {
+		t.Errorf("want ErrVersionMismatch, got %v", err)
+	}
+
+	v2, err := ks.CompareAndSetRaw("hello", json.RawMessage(`"jsonstore"`), v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2 <= v1 {
+		t.Errorf("want a version greater than %d, got %d", v1, v2)
+	}
+	if _, err := ks.CompareAndSetRaw("hello", json.RawMessage(`"stale"`), v1); err != ErrVersionMismatch {
+		t.Errorf("want ErrVersionMismatch, got %v", err)
+	}
+
+	b, version, err := ks.GetRawVersion("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `"jsonstore"` || version != v2 {
+		t.Errorf("want %q at %d, got %q at %d", `"jsonstore"`, v2, b, version)
+	}
+
+	// Set also changes the version
+	ks.Set("hello", "world")
+	if _, err := ks.CompareAndSetRaw("hello", json.RawMessage(`"stale"`), v2); err != ErrVersionMismatch {
+		t.Errorf("want ErrVersionMismatch, got %v", err)
+	}
+	if _, err := ks.CompareAndSetRaw("hello", json.RawMessage(`"any"`), AnyVersion); err != nil {
+		t.Error(err)
+	}
+	if _, err := ks.CompareAndSetRaw("hello", json.RawMessage(`{`), AnyVersion); err != ErrInvalidJSON {
+		t.Errorf("want ErrInvalidJSON, got %v", err)
+	}
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	ks := new(JSONStore)
+	version, _ := ks.CompareAndSetRaw("hello", json.RawMessage(`"world"`), 0)
+
+	if err := ks.CompareAndDelete("hello", version+1); err != ErrVersionMismatch {
+		t.Errorf("want ErrVersionMismatch, got %v", err)
+	}
+	if err := ks.CompareAndDelete("hello", version); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := ks.GetRawVersion("hello"); err != (NoSuchKeyError{"hello"}) {
+		t.Errorf("want NoSuchKeyError, got %v", err)
+	}
+	if err := ks.CompareAndDelete("hello", AnyVersion); err != (NoSuchKeyError{"hello"}) {
+		t.Errorf("want NoSuchKeyError, got %v", err)
+	}
+}
+
+func TestVersionOfLoadedKeys(t *testing.T) {
+	ks := newJSONStore(map[string]json.RawMessage{"hello": json.RawMessage(`"world"`)}, &defaultConfig)
+	_, version, err := ks.GetRawVersion("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("want 1, got %d", version)
+	}
+	newVersion, err := ks.CompareAndSetRaw("hello", json.RawMessage(`"jsonstore"`), version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newVersion == version {
+		t.Error("version must change")
+	}
+}
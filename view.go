@@ -0,0 +1,180 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrReleased is returned when reading a released View.
+var ErrReleased = errors.New("jsonstore: view is released")
+
+// View is a read-only view of a JSONStore frozen at a moment.
+// The changes of the store after the view is taken are not visible from the view.
+// Taking a view is cheap and does not block writers for long, because the view shares
+// the immutable data with the store.
+type View struct {
+	snapshot atomic.Value // *snapshot
+	config   *config
+	release  sync.Once
+}
+
+// Snapshot returns a read-only view of the store at the moment.
+// Call Release when the view is no longer needed, so the memory which is only
+// referenced by the view can be reclaimed.
+// The view of a read-only store keeps the shared memory until it is released, even if the store is closed.
+func (s *JSONStore) Snapshot() *View {
+	s.RLock()
+	defer s.RUnlock()
+	v := &View{
+		config: s.getConfig(),
+	}
+	v.snapshot.Store(s.snapshot(false))
+	if sf := v.config.shared; sf != nil {
+		sf.acquire()
+		// release the shared memory even if Release is not called.
+		runtime.SetFinalizer(v, (*View).Release)
+	}
+	return v
+}
+
+func (v *View) load() *snapshot {
+	snapshot, _ := v.snapshot.Load().(*snapshot)
+	return snapshot
+}
+
+// Release releases the view. The view returns ErrReleased after Release.
+func (v *View) Release() {
+	v.snapshot.Store((*snapshot)(nil))
+	if sf := v.config.shared; sf != nil {
+		v.release.Do(func() { sf.release() })
+	}
+}
+
+// Get will return the value associated with a key at the moment of the view.
+func (v *View) Get(key string, value interface{}) error {
+	b, err := v.GetRawUnsafe(key)
+	if err != nil {
+		return err
+	}
+	return unmarshal(v.config.getCodec(), b, value, v.config.decodeOpts)
+}
+
+// GetRaw returns a copy of the raw JSON value associated with a key.
+func (v *View) GetRaw(key string) (json.RawMessage, error) {
+	b, err := v.GetRawUnsafe(key)
+	if err != nil {
+		return nil, err
+	}
+	return append(json.RawMessage(nil), b...), nil
+}
+
+// GetRawUnsafe returns the raw JSON value associated with a key without copying it.
+// The caller MUST NOT modify the returned value.
+func (v *View) GetRawUnsafe(key string) (json.RawMessage, error) {
+	snapshot := v.load()
+	if snapshot == nil {
+		return nil, ErrReleased
+	}
+	hash := hashKey(key)
+	e, ok := snapshot.trees[shardIndex(hash)].Get(key, hash)
+	if !ok {
+		return nil, NoSuchKeyError{key}
+	}
+	return v.config.decryptFields(key, e.value)
+}
+
+// Set returns ErrReadOnly, because a view can not be modified.
+func (v *View) Set(key string, value interface{}) error {
+	return ErrReadOnly
+}
+
+// Delete does nothing, because a view can not be modified.
+func (v *View) Delete(key string) {
+}
+
+// Keys returns all the keys in the view.
+// It returns nil if the view is released.
+func (v *View) Keys() []string {
+	snapshot := v.load()
+	if snapshot == nil {
+		return nil
+	}
+	keys := make([]string, 0, snapshot.len())
+	snapshot.each(func(key string, e *entry) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Size returns the count element in the view.
+func (v *View) Size() int {
+	snapshot := v.load()
+	if snapshot == nil {
+		return 0
+	}
+	return snapshot.len()
+}
+
+// Range calls fn for each key and value in the view until fn returns false.
+// The order is not specified. value is shared with the store, so fn MUST NOT modify it.
+func (v *View) Range(fn func(key string, value json.RawMessage) bool) {
+	snapshot := v.load()
+	if snapshot == nil {
+		return
+	}
+	snapshot.each(func(key string, e *entry) bool {
+		return fn(key, e.value)
+	})
+}
+
+// RangeSorted is like Range, but it calls fn in the sorted order of the keys.
+// It collects all the keys before the first call of fn to sort them.
+func (v *View) RangeSorted(fn func(key string, value json.RawMessage) bool) {
+	snapshot := v.load()
+	if snapshot == nil {
+		return
+	}
+	type item struct {
+		key   string
+		value json.RawMessage
+	}
+	items := make([]item, 0, snapshot.len())
+	snapshot.each(func(key string, e *entry) bool {
+		items = append(items, item{key, e.value})
+		return true
+	})
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+	for _, it := range items {
+		if !fn(it.key, it.value) {
+			return
+		}
+	}
+}
+
+// WriteTo writes the view to w in the same JSON format as Save, without the footer of the checksum.
+func (v *View) WriteTo(w io.Writer) (int64, error) {
+	snapshot := v.load()
+	if snapshot == nil {
+		return 0, ErrReleased
+	}
+	cw := &countingWriter{w: w}
+	err := snapshot.writeTo(cw)
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
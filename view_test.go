@@ -0,0 +1,103 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	ks := new(JSONStore)
+	ks.Set("human:1", Human{"Dante", 5.4})
+	ks.Set("human:2", Human{"Virgil", 5.8})
+
+	view := ks.Snapshot()
+	defer view.Release()
+
+	// the changes after Snapshot are not visible
+	ks.Set("human:1", Human{"Beatrice", 5.2})
+	ks.Delete("human:2")
+	ks.Set("human:3", Human{"Cato", 6.0})
+
+	var human Human
+	if err := view.Get("human:1", &human); err != nil {
+		t.Fatal(err)
+	}
+	if human.Name != "Dante" {
+		t.Errorf("want Dante, got %s", human.Name)
+	}
+	if err := view.Get("human:2", &human); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := view.GetRaw("human:3"); err != (NoSuchKeyError{"human:3"}) {
+		t.Errorf("want NoSuchKeyError, got %v", err)
+	}
+
+	keys := view.Keys()
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "human:1" || keys[1] != "human:2" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+	if view.Size() != 2 {
+		t.Errorf("want 2, got %d", view.Size())
+	}
+
+	count := 0
+	view.Range(func(key string, value json.RawMessage) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Errorf("Range must stop when fn returns false, called %d times", count)
+	}
+
+	ks.Set("human:0", Human{"Minos", 7.0})
+	var sorted []string
+	view.RangeSorted(func(key string, value json.RawMessage) bool {
+		sorted = append(sorted, key)
+		return true
+	})
+	if want := []string{"human:1", "human:2"}; !reflect.DeepEqual(sorted, want) {
+		t.Errorf("want %v, got %v", want, sorted)
+	}
+
+	var buf bytes.Buffer
+	n, err := view.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("want %d, got %d", buf.Len(), n)
+	}
+	var data map[string]Human
+	if err := json.Unmarshal(buf.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || data["human:1"].Name != "Dante" {
+		t.Errorf("unexpected export: %s", buf.String())
+	}
+}
+
+func TestSnapshotRelease(t *testing.T) {
+	ks := new(JSONStore)
+	ks.Set("hello", "world")
+	view := ks.Snapshot()
+	view.Release()
+
+	var s string
+	if err := view.Get("hello", &s); err != ErrReleased {
+		t.Errorf("want ErrReleased, got %v", err)
+	}
+	if view.Keys() != nil || view.Size() != 0 {
+		t.Error("released view must be empty")
+	}
+	if _, err := view.WriteTo(&bytes.Buffer{}); err != ErrReleased {
+		t.Errorf("want ErrReleased, got %v", err)
+	}
+	view.Range(func(key string, value json.RawMessage) bool {
+		t.Error("released view must be empty")
+		return true
+	})
+}
@@ -0,0 +1,164 @@
+package jsonstore
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// EventType is the type of a change.
+type EventType int
+
+const (
+	// EventSet means that the key is set.
+	EventSet EventType = iota + 1
+
+	// EventDelete means that the key is deleted.
+	EventDelete
+
+	// EventEvict means that the key is deleted because the store exceeds its limits.
+	EventEvict
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	case EventEvict:
+		return "evict"
+	}
+	return "unknown"
+}
+
+// Event is a change of a key.
+// Old and New are shared with the store, so they MUST NOT be modified.
+type Event struct {
+	Type EventType
+	Key  string
+
+	// Old is the value before the change, or nil if the key did not exist.
+	Old json.RawMessage
+
+	// New is the value after the change, or nil if the key is deleted.
+	New json.RawMessage
+
+	// Missed is the number of events dropped just before this event
+	// because the buffer of the watcher was full.
+	Missed int
+}
+
+// WatchBufferSize is the buffer size of the channels returned by Watch.
+const WatchBufferSize = 128
+
+type watcher struct {
+	prefix string
+	ch     chan Event
+	missed int
+}
+
+type notifier struct {
+	// active is the number of watchers and hooks, accessed atomically.
+	// It allows writers to skip locking mu when nobody is listening.
+	active int32
+
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+	hooks    map[*func(Event)]struct{}
+}
+
+// Watch returns a channel that receives the changes of the keys which have the prefix.
+// The channel is closed when ctx is done.
+//
+// The channel has a buffer of WatchBufferSize events.
+// Writers never block on a slow receiver: when the buffer is full, new events are dropped,
+// and the number of dropped events is reported by Event.Missed of the next delivered event.
+func (s *JSONStore) Watch(ctx context.Context, prefix string) <-chan Event {
+	w := &watcher{
+		prefix: prefix,
+		ch:     make(chan Event, WatchBufferSize),
+	}
+	n := &s.notifier
+	n.mu.Lock()
+	if n.watchers == nil {
+		n.watchers = make(map[*watcher]struct{})
+	}
+	n.watchers[w] = struct{}{}
+	atomic.AddInt32(&n.active, 1)
+	n.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		n.mu.Lock()
+		delete(n.watchers, w)
+		atomic.AddInt32(&n.active, -1)
+		close(w.ch)
+		n.mu.Unlock()
+	}()
+	return w.ch
+}
+
+// OnChange registers fn which is called synchronously after each change,
+// before the writing method returns. It is useful for invalidating caches.
+// fn may be called concurrently from multiple goroutines.
+// The store is not locked while fn is called, so fn may call the methods of the store.
+// The returned function unregisters fn.
+func (s *JSONStore) OnChange(fn func(Event)) (remove func()) {
+	n := &s.notifier
+	p := &fn
+	n.mu.Lock()
+	if n.hooks == nil {
+		n.hooks = make(map[*func(Event)]struct{})
+	}
+	n.hooks[p] = struct{}{}
+	atomic.AddInt32(&n.active, 1)
+	n.mu.Unlock()
+	return func() {
+		n.mu.Lock()
+		if _, ok := n.hooks[p]; ok {
+			delete(n.hooks, p)
+			atomic.AddInt32(&n.active, -1)
+		}
+		n.mu.Unlock()
+	}
+}
+
+// publish sends ev to the watchers, and returns the hooks which should be called with ev.
+// The changes must be published in the same order as they are applied.
+func (n *notifier) publish(ev Event) []func(Event) {
+	if atomic.LoadInt32(&n.active) == 0 {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for w := range n.watchers {
+		if !strings.HasPrefix(ev.Key, w.prefix) {
+			continue
+		}
+		ev := ev
+		ev.Missed = w.missed
+		select {
+		case w.ch <- ev:
+			w.missed = 0
+		default:
+			w.missed++
+		}
+	}
+	if len(n.hooks) == 0 {
+		return nil
+	}
+	hooks := make([]func(Event), 0, len(n.hooks))
+	for fn := range n.hooks {
+		hooks = append(hooks, *fn)
+	}
+	return hooks
+}
+
+func callHooks(hooks []func(Event), ev Event) {
+	for _, fn := range hooks {
+		fn(ev)
+	}
+}
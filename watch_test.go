@@ -0,0 +1,101 @@
+package jsonstore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	ks := new(JSONStore)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := ks.Watch(ctx, "human:")
+
+	ks.Set("human:1", "Dante")
+	ks.Set("world:1", "hello")
+	ks.Set("human:1", "Virgil")
+	ks.Delete("human:1")
+	ks.Delete("human:2") // no such key
+
+	want := []Event{
+		{Type: EventSet, Key: "human:1", New: []byte(`"Dante"`)},
+		{Type: EventSet, Key: "human:1", Old: []byte(`"Dante"`), New: []byte(`"Virgil"`)},
+		{Type: EventDelete, Key: "human:1", Old: []byte(`"Virgil"`)},
+	}
+	for _, w := range want {
+		select {
+		case ev := <-ch:
+			if ev.Type != w.Type || ev.Key != w.Key || string(ev.Old) != string(w.Old) || string(ev.New) != string(w.New) {
+				t.Errorf("want %v, got %v", w, ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	cancel()
+	select {
+	case ev, ok := <-ch:
+		if ok {
+			t.Errorf("unexpected event: %v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the channel is not closed")
+	}
+
+	// changes after cancel must not panic
+	ks.Set("human:1", "Dante")
+}
+
+func TestWatchOverflow(t *testing.T) {
+	ks := new(JSONStore)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := ks.Watch(ctx, "")
+
+	const extra = 10
+	for i := 0; i < WatchBufferSize+extra; i++ {
+		ks.Set(key(i), i)
+	}
+	for i := 0; i < WatchBufferSize; i++ {
+		ev := <-ch
+		if ev.Key != key(i) || ev.Missed != 0 {
+			t.Errorf("unexpected event: %v", ev)
+		}
+	}
+
+	ks.Set("last", 0)
+	ev := <-ch
+	if ev.Key != "last" || ev.Missed != extra {
+		t.Errorf("want %d missed events, got %v", extra, ev)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	ks := new(JSONStore)
+	var mu sync.Mutex
+	var events []Event
+	remove := ks.OnChange(func(ev Event) {
+		// the store is not locked
+		if _, err := ks.GetRaw(ev.Key); (err != nil) != (ev.Type == EventDelete) {
+			t.Errorf("unexpected state: %v", err)
+		}
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	})
+
+	ks.Set("hello", "world")
+	ks.Delete("hello")
+	remove()
+	ks.Set("hello", "world")
+
+	if len(events) != 2 {
+		t.Fatalf("want 2 events, got %d", len(events))
+	}
+	if events[0].Type != EventSet || events[1].Type != EventDelete {
+		t.Errorf("unexpected events: %v", events)
+	}
+}